@@ -0,0 +1,213 @@
+package apigo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AGGridAdapter AG Grid server-side row model 协议, 不支持行分组和透视
+type AGGridAdapter struct{}
+
+type agGridSort struct {
+	ColID string `json:"colId"`
+	Sort  string `json:"sort"`
+}
+
+type agGridFilter struct {
+	FilterType string         `json:"filterType"`
+	Type       string         `json:"type"`
+	Filter     any            `json:"filter"`
+	FilterTo   any            `json:"filterTo"`
+	DateFrom   string         `json:"dateFrom"`
+	DateTo     string         `json:"dateTo"`
+	Values     []any          `json:"values"`
+	Operator   string         `json:"operator"`
+	Conditions []agGridFilter `json:"conditions"`
+}
+
+type agGridRequest struct {
+	StartRow    int                     `json:"startRow"`
+	EndRow      int                     `json:"endRow"`
+	SortModel   []agGridSort            `json:"sortModel"`
+	FilterModel map[string]agGridFilter `json:"filterModel"`
+	GroupKeys   []string                `json:"groupKeys"`
+}
+
+type agGridResponse struct {
+	RowData  any    `bson:"rowData" json:"rowData"`
+	RowCount *int64 `bson:"rowCount,omitempty" json:"rowCount,omitempty"`
+}
+
+// MarshalJSON 格式化
+func (response *agGridResponse) MarshalJSON() ([]byte, error) {
+	return bson.MarshalExtJSON(response, false, true)
+}
+
+// agGridTypes AG Grid 过滤类型对应的 QueryFilter 类型
+var agGridTypes = map[string]string{
+	"equals":             "=",
+	"notEqual":           "!=",
+	"contains":           "like",
+	"notContains":        "notlike",
+	"startsWith":         "starts",
+	"endsWith":           "ends",
+	"lessThan":           "<",
+	"lessThanOrEqual":    "<=",
+	"greaterThan":        ">",
+	"greaterThanOrEqual": ">=",
+	"inRange":            "between",
+	"blank":              "empty",
+	"notBlank":           "notempty",
+}
+
+// query 转换为 QueryFilter, AND 组合的条件展开为多个
+func (filter *agGridFilter) query(field string) ([]QueryFilter, error) {
+	if len(filter.Conditions) > 0 {
+		var conditions []QueryFilter
+		for i := range filter.Conditions {
+			condition, err := filter.Conditions[i].query(field)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition...)
+		}
+		if strings.EqualFold(filter.Operator, "OR") {
+			return []QueryFilter{{Field: field, Or: conditions}}, nil
+		}
+		return conditions, nil
+	}
+	if filter.FilterType == "set" {
+		return []QueryFilter{{Field: field, Type: "in", Value: filter.Values}}, nil
+	}
+	op, ok := agGridTypes[filter.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported filter type %q", filter.Type)
+	}
+	from, to := filter.Filter, filter.FilterTo
+	if filter.FilterType == "date" {
+		from, to = filter.DateFrom, filter.DateTo
+	}
+	if op == "between" {
+		return []QueryFilter{{Field: field, Type: op, Value: []any{from, to}}}, nil
+	}
+	return []QueryFilter{{Field: field, Type: op, Value: from}}, nil
+}
+
+func (AGGridAdapter) Parse(ctx *gin.Context) (*QueryRequest, error) {
+	var request agGridRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		return nil, err
+	}
+	if len(request.GroupKeys) > 0 {
+		return nil, fmt.Errorf("row grouping is not supported")
+	}
+	if request.StartRow < 0 || request.EndRow < request.StartRow {
+		return nil, errInvalidPage
+	}
+	query := &QueryRequest{Page: 1, Size: request.EndRow - request.StartRow, Offset: request.StartRow}
+	for _, model := range request.SortModel {
+		query.Sorters = append(query.Sorters, QuerySort{Field: model.ColID, Dir: model.Sort})
+	}
+	fields := make([]string, 0, len(request.FilterModel))
+	for field := range request.FilterModel {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		model := request.FilterModel[field]
+		filters, err := model.query(field)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = append(query.Filter, filters...)
+	}
+	return query, nil
+}
+
+func (AGGridAdapter) Write(ctx *gin.Context, request *QueryRequest, result *QueryResult) {
+	response := &agGridResponse{RowData: result.Data}
+	if result.Total >= 0 {
+		response.RowCount = &result.Total
+	} else if !result.More {
+		// 最后一块, 总数已知
+		count := int64(request.Offset + (request.Page-1)*request.Size + result.Count)
+		response.RowCount = &count
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// QueryStringAdapter 查询字符串协议:
+// ?page=2&size=20&sort=-age,name&filter=age:>=:18&filter=name:like:jo&cursor=...
+// 响应: {data, total, page, size, last_page, next_cursor, more}
+type QueryStringAdapter struct{}
+
+type queryStringResponse struct {
+	Data       any    `bson:"data" json:"data"`
+	Total      *int64 `bson:"total,omitempty" json:"total,omitempty"`
+	Page       int    `bson:"page" json:"page"`
+	Size       int    `bson:"size" json:"size"`
+	LastPage   int    `bson:"last_page" json:"last_page"`
+	NextCursor string `bson:"next_cursor,omitempty" json:"next_cursor,omitempty"`
+	More       bool   `bson:"more" json:"more"`
+}
+
+// MarshalJSON 格式化
+func (response *queryStringResponse) MarshalJSON() ([]byte, error) {
+	return bson.MarshalExtJSON(response, false, true)
+}
+
+func (QueryStringAdapter) Parse(ctx *gin.Context) (*QueryRequest, error) {
+	request := &QueryRequest{Cursor: ctx.Query("cursor")}
+	var err error
+	if value := ctx.Query("page"); value != "" {
+		if request.Page, err = strconv.Atoi(value); err != nil {
+			return nil, errInvalidPage
+		}
+	}
+	if value := ctx.Query("size"); value != "" {
+		if request.Size, err = strconv.Atoi(value); err != nil {
+			return nil, errInvalidPage
+		}
+	}
+	for _, value := range ctx.QueryArray("sort") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(field, "-"); ok {
+				request.Sorters = append(request.Sorters, QuerySort{Field: name, Dir: "desc"})
+			} else {
+				request.Sorters = append(request.Sorters, QuerySort{Field: strings.TrimPrefix(field, "+"), Dir: "asc"})
+			}
+		}
+	}
+	for _, value := range ctx.QueryArray("filter") {
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid filter %q, want field:type:value", value)
+		}
+		request.Filter = append(request.Filter, QueryFilter{Field: parts[0], Type: parts[1], Value: parts[2]})
+	}
+	return request, nil
+}
+
+func (QueryStringAdapter) Write(ctx *gin.Context, request *QueryRequest, result *QueryResult) {
+	response := &queryStringResponse{
+		Data:       result.Data,
+		Page:       request.Page,
+		Size:       request.Size,
+		LastPage:   result.LastPage,
+		NextCursor: result.NextCursor,
+		More:       result.More,
+	}
+	if result.Total >= 0 {
+		response.Total = &result.Total
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,331 @@
+package apigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MaxBatchSize 一次批量调用的最大条数
+var MaxBatchSize = 100
+
+// recordedResponse 记录 handler 的响应
+type recordedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (response *recordedResponse) Header() http.Header {
+	return response.header
+}
+
+func (response *recordedResponse) Write(data []byte) (int, error) {
+	if response.status == 0 {
+		response.status = http.StatusOK
+	}
+	return response.body.Write(data)
+}
+
+func (response *recordedResponse) WriteHeader(status int) {
+	if response.status == 0 {
+		response.status = status
+	}
+}
+
+func (response *recordedResponse) Flush() {}
+
+var errStreamCall = errors.New("streaming method not supported in batch, JSON-RPC or socket calls")
+
+// dispatch 将调用作为 HTTP 请求交给 App, 经过全部中间件, 返回状态码和 envelope
+// 只允许 HandleAPI 注册的非流方法; 客户端地址取自外层请求 origin
+func (s *Server) dispatch(ctx context.Context, method, path string, header http.Header, origin *http.Request, body []byte) (int, json.RawMessage) {
+	api, ok := s.apis[method+" "+path]
+	if !ok || strings.ContainsAny(path, "?#") {
+		return http.StatusNotFound, nil
+	}
+	if api.Stream {
+		data, _ := json.Marshal(&messageBase{Code: http.StatusNotImplemented, Error: errStreamCall.Error()})
+		return http.StatusOK, data
+	}
+	request, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	// 压缩后的响应无法嵌入
+	request.Header.Del("Accept-Encoding")
+	request.Header.Del("Content-Length")
+	request.Header.Set("Content-Type", "application/json")
+	// 调用中的 X-Forwarded-For 等由客户端提供, 以外层请求为准
+	for _, key := range s.App.RemoteIPHeaders {
+		request.Header.Del(key)
+		if values := origin.Header.Values(key); len(values) > 0 {
+			request.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	request.RemoteAddr = origin.RemoteAddr
+	response := &recordedResponse{header: make(http.Header)}
+	s.App.ServeHTTP(response, request)
+	if !json.Valid(response.body.Bytes()) {
+		return response.status, nil
+	}
+	return response.status, response.body.Bytes()
+}
+
+// dispatchCode dispatch 没有返回 envelope 时对应的 envelope code 和错误
+func dispatchCode(status int) (int, string) {
+	if status >= http.StatusBadRequest {
+		return status, http.StatusText(status)
+	}
+	// 成功的状态码但响应不是 envelope
+	return http.StatusInternalServerError, "invalid response"
+}
+
+// lookupCall 查找 Service.Method 对应的 HTTP 方法和路径
+func (s *Server) lookupCall(name string) (string, string, bool) {
+	route, ok := s.calls[name]
+	if !ok {
+		return "", "", false
+	}
+	method, path, _ := strings.Cut(route, " ")
+	return method, path, true
+}
+
+// batchRequest 批量调用中的一项, method 为 Service.Method
+type batchRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// batchResponse 批量调用中一项的结果, 即带 id 的 envelope
+type batchResponse struct {
+	ID        json.RawMessage `json:"id,omitempty"`
+	Code      int             `json:"code"`
+	Error     string          `json:"error,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// HandleBatch 在 path 注册批量调用接口
+// 请求为 [{id, method: "Service.Method", params}], 返回同序的 [{id, code, error, data}]
+// concurrency: 同时执行的最大调用数, <= 0 时为 1
+func (s *Server) HandleBatch(path string, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	s.App.POST(path, func(ctx *gin.Context) {
+		var requests []batchRequest
+		if err := ctx.ShouldBindJSON(&requests); err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if len(requests) > MaxBatchSize {
+			s.ResponseError(ctx, http.StatusBadRequest, fmt.Errorf("batch size %d exceeds %d", len(requests), MaxBatchSize))
+			return
+		}
+		responses := make([]*batchResponse, len(requests))
+		runLimited(len(requests), concurrency, func(i int) {
+			responses[i] = s.serveBatchCall(ctx, &requests[i])
+		})
+		ctx.Set(codeKey, 0)
+		ctx.JSON(http.StatusOK, responses)
+	})
+}
+
+// runLimited 并发执行 run(0..n-1), 最多同时 concurrency 个
+func runLimited(n, concurrency int, run func(i int)) {
+	limit := make(chan struct{}, concurrency)
+	var wait sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wait.Add(1)
+		limit <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-limit
+				wait.Done()
+			}()
+			run(i)
+		}(i)
+	}
+	wait.Wait()
+}
+
+// serveBatchCall 执行批量调用中的一项
+func (s *Server) serveBatchCall(ctx *gin.Context, request *batchRequest) *batchResponse {
+	response := &batchResponse{ID: request.ID}
+	method, path, ok := s.lookupCall(request.Method)
+	if !ok {
+		response.Code = http.StatusNotFound
+		response.Error = fmt.Sprintf("unknown method %q", request.Method)
+		return response
+	}
+	var body []byte
+	if len(request.Params) > 0 && !bytes.Equal(request.Params, []byte("null")) {
+		body = request.Params
+	}
+	header := ctx.Request.Header.Clone()
+	header.Del(RequestIDHeader)
+	status, data := s.dispatch(ctx.Request.Context(), method, path, header, ctx.Request, body)
+	if status != http.StatusOK || data == nil {
+		response.Code, response.Error = dispatchCode(status)
+		return response
+	}
+	// envelope 与 batchResponse 字段相同
+	if err := json.Unmarshal(data, response); err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Error = err.Error()
+	}
+	response.ID = request.ID
+	return response
+}
+
+// Batch 客户端的批量调用, 通过生成客户端的 <Method>Batch 或 BatchCall 添加调用后 Do 一次发送
+//
+//	batch := client.Batch("/api/batch")
+//	users := NewUserServiceClient(client)
+//	hello := users.HelloBatch(batch, "bob")
+//	// 等同于 apigo.BatchCall[UserServiceHelloResponse](batch, "UserService.Hello", &UserServiceHelloRequest{Name: "bob"})
+//	if err := batch.Do(); err != nil {...}
+//	resp, err := hello.Result()
+type Batch struct {
+	client *Client
+	path   string
+	calls  []batchCall
+}
+
+type batchCall interface {
+	request() (*batchRequest, error)
+	resolve(response *batchResponse, withBSON bool)
+}
+
+// Batch 创建发往 path 的批量调用
+func (c *Client) Batch(path string) *Batch {
+	return &Batch{client: c, path: path}
+}
+
+// BatchResult 批量调用中一项的结果, Do 之后可用
+type BatchResult[T any] struct {
+	method string
+	params json.RawMessage
+	err    error
+	data   *T
+	done   bool
+}
+
+func (result *BatchResult[T]) request() (*batchRequest, error) {
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &batchRequest{Method: result.method, Params: result.params}, nil
+}
+
+func (result *BatchResult[T]) resolve(response *batchResponse, withBSON bool) {
+	result.done = true
+	if response.Code != 0 {
+		result.err = errors.New(response.Error)
+		return
+	}
+	if len(response.Data) == 0 || bytes.Equal(response.Data, []byte("null")) {
+		return
+	}
+	if withBSON {
+		// data 可能不是文档, 放回 envelope 中读取
+		var msg message[T]
+		envelope := append(append([]byte(`{"data":`), response.Data...), '}')
+		if result.err = bson.UnmarshalExtJSON(envelope, false, &msg); result.err == nil {
+			result.data = &msg.Data
+		}
+		return
+	}
+	var data T
+	if result.err = json.Unmarshal(response.Data, &data); result.err == nil {
+		result.data = &data
+	}
+}
+
+// Result 返回调用结果, Do 之前或 Do 失败时返回错误
+func (result *BatchResult[T]) Result() (*T, error) {
+	if !result.done && result.err == nil {
+		return nil, fmt.Errorf("batch: %s not executed", result.method)
+	}
+	return result.data, result.err
+}
+
+// BatchCall 向 batch 添加一次 Service.Method 调用, params 为请求结构
+func BatchCall[T any](batch *Batch, method string, params any) *BatchResult[T] {
+	result := &BatchResult[T]{method: method}
+	if params != nil {
+		var err error
+		if batch.client.WithBSON {
+			result.params, err = bson.MarshalExtJSON(params, false, true)
+		} else {
+			result.params, err = json.Marshal(params)
+		}
+		result.err = err
+	}
+	batch.calls = append(batch.calls, result)
+	return result
+}
+
+// Do 发送所有调用, 每项的错误通过 BatchResult.Result 返回
+func (batch *Batch) Do() error {
+	requests := make([]*batchRequest, 0, len(batch.calls))
+	resolved := make([]bool, len(batch.calls))
+	for i, call := range batch.calls {
+		request, err := call.request()
+		if err != nil {
+			// 参数编码失败的调用不发送
+			resolved[i] = true
+			continue
+		}
+		request.ID = json.RawMessage(strconv.Itoa(i))
+		requests = append(requests, request)
+	}
+	data, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	if err = doRequest(context.Background(), batch.client, batch.path, http.MethodPost, data, &raw); err != nil {
+		return err
+	}
+	if raw = bytes.TrimSpace(raw); len(raw) == 0 || raw[0] != '[' {
+		// 整体失败时返回 envelope
+		var msg messageBase
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return err
+		}
+		return errors.New(msg.Error)
+	}
+	var responses []*batchResponse
+	if err = json.Unmarshal(raw, &responses); err != nil {
+		return err
+	}
+	for _, response := range responses {
+		index, err := strconv.Atoi(string(response.ID))
+		if err != nil || index < 0 || index >= len(batch.calls) || resolved[index] {
+			continue
+		}
+		resolved[index] = true
+		batch.calls[index].resolve(response, batch.client.WithBSON)
+	}
+	for i, call := range batch.calls {
+		if !resolved[i] {
+			call.resolve(&batchResponse{Code: http.StatusInternalServerError, Error: "batch: missing response"}, false)
+		}
+	}
+	return nil
+}
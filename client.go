@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	"github.com/zdypro888/net"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -15,6 +19,14 @@ type Client struct {
 	client   *net.HTTP
 	host     string
 	WithBSON bool
+	// Metrics 可选, 记录每次请求的结果
+	Metrics ClientMetrics
+	// Tracer 可选, 为每次请求创建 span 并传递 traceparent
+	Tracer *Tracer
+	// StreamClient 用于 SSE 流, NewClient 按 host 使用与请求相同的协议(https 为 HTTP/3)
+	StreamClient *http.Client
+	socket       *clientSocket
+	socketMutex  sync.Mutex
 }
 
 func (c *Client) BuildURL(p string) string {
@@ -34,14 +46,25 @@ func NewClient(host string) *Client {
 	}
 	if strings.HasPrefix(host, "http://") {
 		client.client = net.NewHTTP(nil)
+		client.StreamClient = &http.Client{}
 	} else {
 		client.client = net.NewHTTP3()
+		client.StreamClient = &http.Client{Transport: &http3.RoundTripper{}}
 	}
 	return client
 }
 
-func doRequest(c *Client, path string, method string, request any, response any) error {
-	var err error
+func doRequest(ctx context.Context, c *Client, path string, method string, request any, response any) (err error) {
+	if c.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			var code int
+			if env, ok := response.(envelope); ok && err == nil {
+				code = env.envelopeCode()
+			}
+			c.Metrics.ObserveRequest(path, method, code, err, time.Since(start))
+		}()
+	}
 	var data []byte
 	if request == nil {
 		data = nil
@@ -56,17 +79,42 @@ func doRequest(c *Client, path string, method string, request any, response any)
 			return err
 		}
 	}
-	var res *net.Response
-	if res, err = c.client.RequestMethod(context.Background(), c.BuildURL(path), method, nil, net.NewReader(data)); err != nil {
-		return err
-	}
-	if res.StatusCode != http.StatusOK {
-		return res
+	headers := http.Header{}
+	headers.Set(RequestIDHeader, outgoingRequestID(ctx))
+	if span := c.traceRequest(ctx, path, method, headers); span != nil {
+		defer func() {
+			if env, ok := response.(envelope); ok && err == nil {
+				span.SetAttribute("apigo.code", env.envelopeCode())
+			}
+			span.SetError(err)
+			span.Finish()
+		}()
 	}
-	if data, err = res.Data(); err != nil {
-		return err
+	if socket := c.currentSocket(); socket != nil {
+		target := path
+		if u, err := url.Parse(path); err == nil && u.IsAbs() {
+			target = u.RequestURI()
+		} else if !strings.HasPrefix(target, "/") {
+			target = "/" + target
+		}
+		if data, err = socket.call(ctx, method, target, headers, data); err != nil {
+			return err
+		}
+	} else {
+		var res *net.Response
+		if res, err = c.client.RequestMethod(ctx, c.BuildURL(path), method, headers, net.NewReader(data)); err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			return res
+		}
+		if data, err = res.Data(); err != nil {
+			return err
+		}
 	}
-	if c.WithBSON {
+	if raw, ok := response.(*[]byte); ok {
+		*raw = data
+	} else if c.WithBSON {
 		if err = bson.UnmarshalExtJSON(data, false, response); err != nil {
 			return err
 		}
@@ -79,8 +127,13 @@ func doRequest(c *Client, path string, method string, request any, response any)
 }
 
 func Notify(c *Client, path string, method string, body any) error {
+	return NotifyContext(context.Background(), c, path, method, body)
+}
+
+// NotifyContext 同 Notify, ctx 用于取消请求和传递 span, 其中的请求 ID(WithRequestID) 会被沿用
+func NotifyContext(ctx context.Context, c *Client, path string, method string, body any) error {
 	var msg messageBase
-	if err := doRequest(c, path, method, body, &msg); err != nil {
+	if err := doRequest(ctx, c, path, method, body, &msg); err != nil {
 		return err
 	}
 	if msg.Code != 0 {
@@ -90,8 +143,13 @@ func Notify(c *Client, path string, method string, body any) error {
 }
 
 func Request[T any](c *Client, path string, method string, body any) (*T, error) {
+	return RequestContext[T](context.Background(), c, path, method, body)
+}
+
+// RequestContext 同 Request, ctx 用于取消请求和传递 span, 其中的请求 ID(WithRequestID) 会被沿用
+func RequestContext[T any](ctx context.Context, c *Client, path string, method string, body any) (*T, error) {
 	var msg message[*T]
-	if err := doRequest(c, path, method, body, &msg); err != nil {
+	if err := doRequest(ctx, c, path, method, body, &msg); err != nil {
 		return nil, err
 	}
 	if msg.Code != 0 {
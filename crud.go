@@ -0,0 +1,344 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound CRUDStore 中没有对应的记录
+var ErrNotFound = errors.New("not found")
+
+// CRUDStore HandleCRUD 的写入和按 ID 读取
+type CRUDStore[T any] interface {
+	// Collection List 查询的集合, 通过 Query 和 WithDatabase 读取
+	Collection() *mongo.Collection
+	Get(ctx context.Context, id any) (*T, error)
+	// Create 插入并返回新记录的 ID
+	Create(ctx context.Context, object *T) (any, error)
+	// Update 整体替换
+	Update(ctx context.Context, id any, object *T) error
+	// Patch 只修改 fields 中的字段, key 为 bson 路径
+	Patch(ctx context.Context, id any, fields bson.D) error
+	Delete(ctx context.Context, id any) error
+}
+
+// MongoStore 使用 MongoDB 集合的 CRUDStore, 读写和 List 都使用同一个集合
+type MongoStore[T any] struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore 创建 MongoStore, collection 应使用 idatabase 的连接, 如 database.Collection(name)
+func NewMongoStore[T any](collection *mongo.Collection) *MongoStore[T] {
+	return &MongoStore[T]{collection: collection}
+}
+
+func (store *MongoStore[T]) Collection() *mongo.Collection {
+	return store.collection
+}
+
+func (store *MongoStore[T]) Get(ctx context.Context, id any) (*T, error) {
+	var object T
+	err := store.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&object)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+func (store *MongoStore[T]) Create(ctx context.Context, object *T) (any, error) {
+	result, err := store.collection.InsertOne(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	return result.InsertedID, nil
+}
+
+func (store *MongoStore[T]) Update(ctx context.Context, id any, object *T) error {
+	result, err := store.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: id}}, object)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *MongoStore[T]) Patch(ctx context.Context, id any, fields bson.D) error {
+	result, err := store.collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$set", Value: fields}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *MongoStore[T]) Delete(ctx context.Context, id any) error {
+	result, err := store.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CRUDRequest HandleCRUD 的请求
+type CRUDRequest[T any] struct {
+	ID     any            `json:"id,omitempty" bson:"id,omitempty"`
+	Data   *T             `json:"data,omitempty" bson:"data,omitempty"`
+	Fields map[string]any `json:"fields,omitempty" bson:"fields,omitempty"`
+}
+
+// CRUDCreated Create 的结果, ID 为模型 _id 的类型
+type CRUDCreated[ID any] struct {
+	ID ID `json:"id" bson:"id"`
+}
+
+// crudCode 错误对应的 code
+func crudCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errQuery):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// HandleCRUD 注册 T 的 List(Tabulator)/Get/Create/Update/Patch/Delete 接口, 路径为 path/<Method>
+// List 查询 store.Collection(), 默认 WithDatabase 为其所在的数据库
+// options 作用于 List, WithQueryFields 同时限制 Get 的返回和 Create/Update/Patch 的字段
+// 指定白名单时 Create 忽略白名单外的字段; Update 以 $set 只修改请求中出现的白名单字段,
+// 带 omitempty 的字段为零值时不会出现在请求中, 因此不会被清空, 需要清空时使用 Patch
+func HandleCRUD[T any](s *Server, service, path string, store CRUDStore[T], options ...QueryOption) {
+	collection := store.Collection()
+	options = append([]QueryOption{WithDatabase(collection.Database())}, options...)
+	opts := newQueryOptions[T](options)
+	idType, _ := bsonFieldType(reflect.TypeOf((*T)(nil)).Elem(), "_id")
+	readID := func(ctx *gin.Context) (*CRUDRequest[T], any, bool) {
+		req, err := ReadMessage[CRUDRequest[T]](s, ctx)
+		if err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return nil, nil, false
+		}
+		if req.ID == nil {
+			s.ResponseError(ctx, http.StatusBadRequest, fmt.Errorf("%w: missing id", errQuery))
+			return nil, nil, false
+		}
+		id, err := filterValue(idType, req.ID)
+		if err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return nil, nil, false
+		}
+		return req, id, true
+	}
+	s.HandleAPI(http.MethodPost, service, "List", path+"/List", func(ctx *gin.Context) {
+		Query[T](ctx, TabulatorAdapter{}, collection.Name(), nil, options...)
+	})
+	s.HandleAPI(http.MethodPost, service, "Get", path+"/Get", func(ctx *gin.Context) {
+		_, id, ok := readID(ctx)
+		if !ok {
+			return
+		}
+		object, err := store.Get(ctx.Request.Context(), id)
+		if err != nil {
+			s.ResponseError(ctx, crudCode(err), err)
+			return
+		}
+		if !opts.spec.projects() {
+			s.ResponseData(ctx, object)
+		} else if document, err := opts.spec.project(object); err != nil {
+			s.ResponseError(ctx, http.StatusInternalServerError, err)
+		} else {
+			s.ResponseData(ctx, document)
+		}
+	})
+	s.HandleAPI(http.MethodPost, service, "Create", path+"/Create", func(ctx *gin.Context) {
+		req, err := ReadMessage[CRUDRequest[T]](s, ctx)
+		if err != nil || req.Data == nil {
+			s.ResponseError(ctx, http.StatusBadRequest, fmt.Errorf("%w: missing data", errQuery))
+			return
+		}
+		object, err := allowedObject(opts.spec, req.Data)
+		if err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		id, err := store.Create(ctx.Request.Context(), object)
+		if err != nil {
+			s.ResponseError(ctx, crudCode(err), err)
+			return
+		}
+		s.ResponseData(ctx, &CRUDCreated[any]{ID: id})
+	})
+	s.HandleAPI(http.MethodPost, service, "Update", path+"/Update", func(ctx *gin.Context) {
+		req, id, ok := readID(ctx)
+		if !ok {
+			return
+		}
+		if req.Data == nil {
+			s.ResponseError(ctx, http.StatusBadRequest, fmt.Errorf("%w: missing data", errQuery))
+			return
+		}
+		var err error
+		if opts.spec.projects() {
+			var fields bson.D
+			if fields, err = allowedFields(opts.spec, req.Data); err != nil || len(fields) == 0 {
+				s.ResponseError(ctx, http.StatusBadRequest, fmt.Errorf("%w: no writable fields", errQuery))
+				return
+			}
+			err = store.Patch(ctx.Request.Context(), id, fields)
+		} else {
+			err = store.Update(ctx.Request.Context(), id, req.Data)
+		}
+		if err != nil {
+			s.ResponseError(ctx, crudCode(err), err)
+			return
+		}
+		s.ResponseData(ctx, nil)
+	})
+	s.HandleAPI(http.MethodPost, service, "Patch", path+"/Patch", func(ctx *gin.Context) {
+		req, id, ok := readID(ctx)
+		if !ok {
+			return
+		}
+		fields, err := patchFields(opts.spec, req.Fields)
+		if err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.Patch(ctx.Request.Context(), id, fields); err != nil {
+			s.ResponseError(ctx, crudCode(err), err)
+			return
+		}
+		s.ResponseData(ctx, nil)
+	})
+	s.HandleAPI(http.MethodPost, service, "Delete", path+"/Delete", func(ctx *gin.Context) {
+		_, id, ok := readID(ctx)
+		if !ok {
+			return
+		}
+		if err := store.Delete(ctx.Request.Context(), id); err != nil {
+			s.ResponseError(ctx, crudCode(err), err)
+			return
+		}
+		s.ResponseData(ctx, nil)
+	})
+}
+
+// allowedFields object 中白名单字段(_id 除外)的值, key 为 bson 路径
+func allowedFields(spec *QuerySpec, object any) (bson.D, error) {
+	raw, err := bson.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.D
+	for _, field := range spec.order {
+		if field.Path == "_id" {
+			continue
+		}
+		if value, err := bson.Raw(raw).LookupErr(strings.Split(field.Path, ".")...); err == nil {
+			fields = append(fields, bson.E{Key: field.Path, Value: value})
+		}
+	}
+	return fields, nil
+}
+
+// allowedObject 只保留 object 中白名单的字段, 其余为零值; 未指定白名单时原样返回
+func allowedObject[T any](spec *QuerySpec, object *T) (*T, error) {
+	if !spec.projects() {
+		return object, nil
+	}
+	raw, err := bson.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	document := bson.D{}
+	for _, field := range spec.order {
+		path := strings.Split(field.Path, ".")
+		if value, err := bson.Raw(raw).LookupErr(path...); err == nil {
+			document = setPath(document, path, value)
+		}
+	}
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var allowed T
+	if err = bson.Unmarshal(data, &allowed); err != nil {
+		return nil, err
+	}
+	return &allowed, nil
+}
+
+// patchFields 按白名单检查 Patch 的字段, 并将值转换为字段类型
+func patchFields(spec *QuerySpec, values map[string]any) (bson.D, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: missing fields", errQuery)
+	}
+	var fields bson.D
+	for column, value := range values {
+		field, err := spec.Field(column)
+		if err != nil || field.Path == "_id" {
+			return nil, fmt.Errorf("%w: unknown field %q", errQuery, column)
+		}
+		if !compositeType(field.Type) {
+			if value, err = filterValue(field.Type, value); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errQuery, column, err)
+			}
+		}
+		fields = append(fields, bson.E{Key: field.Path, Value: value})
+	}
+	return fields, nil
+}
+
+// compositeType 数组、map 和结构体(时间和 ObjectID 除外)按原值写入
+func compositeType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Map:
+		return true
+	case reflect.Struct:
+		return t != timeType
+	}
+	return false
+}
+
+// TabulatorResult ListTabulator 的结果
+type TabulatorResult[T any] struct {
+	LastPage   int    `json:"last_page" bson:"last_page"`
+	Data       []T    `json:"data" bson:"data"`
+	NextCursor string `json:"next_cursor,omitempty" bson:"next_cursor,omitempty"`
+}
+
+// ListTabulator 调用 TabulatorQuery 或 HandleCRUD 的 List 接口
+func ListTabulator[T any](c *Client, path string, request *TabulatorRequest) (*TabulatorResult[T], error) {
+	return ListTabulatorContext[T](context.Background(), c, path, request)
+}
+
+// ListTabulatorContext 同 ListTabulator, ctx 用于取消请求和传递 span
+func ListTabulatorContext[T any](ctx context.Context, c *Client, path string, request *TabulatorRequest) (*TabulatorResult[T], error) {
+	var result TabulatorResult[T]
+	if err := doRequest(ctx, c, path, http.MethodPost, request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,417 @@
+package apigo
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zdypro888/idatabase"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultExportLimit TabulatorExport 未指定 WithExportLimit 时最多导出的行数
+const DefaultExportLimit = 10000
+
+// ExportTruncatedHeader 结果超过上限被截断时返回的响应头
+const ExportTruncatedHeader = "X-Export-Truncated"
+
+type tabulatorExportRequest struct {
+	Sorters []QuerySort   `json:"sort"`
+	Filter  []QueryFilter `json:"filter"`
+	Format  string        `json:"format"` // csv, xlsx, ndjson
+}
+
+// exportCell 一个单元格, number 为 true 时 xlsx 中写为数字
+type exportCell struct {
+	text   string
+	number bool
+}
+
+// exportWriter 导出格式
+type exportWriter interface {
+	header(fields []*QueryField) error
+	row(fields []*QueryField, document bson.Raw) error
+	close() error
+}
+
+// TabulatorExport 按 Tabulator 的排序和过滤(不分页)导出结果, 格式为 csv/xlsx/ndjson
+// 格式取自请求的 format 或查询参数 format, 默认 csv
+// 超过 WithExportLimit 时截断并设置 X-Export-Truncated; WithQueryFields 同时决定导出的列
+// 设置 WithDatabase 时逐行读取游标并输出, 否则通过 idatabase 一次读取全部结果
+func TabulatorExport[T any](ctx *gin.Context, collection string, selector any, options ...QueryOption) {
+	opts := newQueryOptions[T](options)
+	fields, limit := opts.spec, opts.exportLimit
+	if limit <= 0 {
+		limit = DefaultExportLimit
+	}
+	var request tabulatorExportRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.BindJSON(&request); err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+	format := request.Format
+	if format == "" {
+		format = ctx.DefaultQuery("format", "csv")
+	}
+	writer, contentType, err := newExportWriter(format, ctx.Writer)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	query := &idatabase.QueryAny[T]{}
+	query.Collection = collection
+	query.Limit = limit
+	if query.Sorts, err = buildSorts(fields, request.Sorters); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	query.Check()
+	if selector, err = buildSelector(fields, request.Filter, selector, opts.regexLimit); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	rows, truncated, err := openExportRows(ctx.Request.Context(), opts, query, selector, limit)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.close()
+	if truncated {
+		ctx.Header(ExportTruncatedHeader, "true")
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, collection+"."+format))
+	ctx.Status(http.StatusOK)
+	columns := fields.Fields()
+	if err = writer.header(columns); err != nil {
+		ctx.Error(err)
+		return
+	}
+	for {
+		document, err := rows.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// 已开始输出, 只能中断
+			ctx.Error(err)
+			return
+		}
+		if err = writer.row(columns, document); err != nil {
+			ctx.Error(err)
+			return
+		}
+	}
+	if err = writer.close(); err != nil {
+		ctx.Error(err)
+	}
+}
+
+var errExportFormat = errors.New("unsupported export format")
+
+// newExportWriter 按格式创建输出, 在查询前检查格式
+func newExportWriter(format string, out io.Writer) (exportWriter, string, error) {
+	switch format {
+	case "csv":
+		return &csvExport{out: out, writer: csv.NewWriter(out)}, "text/csv; charset=utf-8", nil
+	case "ndjson":
+		return &ndjsonExport{writer: bufio.NewWriter(out)}, "application/x-ndjson", nil
+	case "xlsx":
+		return &xlsxExport{zip: zip.NewWriter(out)}, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", nil
+	}
+	return nil, "", fmt.Errorf("%w %q", errExportFormat, format)
+}
+
+// exportRows 导出的结果, next 结束时返回 io.EOF
+type exportRows interface {
+	next() (bson.Raw, error)
+	close()
+}
+
+// openExportRows 设置 WithDatabase 时打开游标, 截断通过限量计数判断; 否则读取 limit+1 行
+func openExportRows[T any](ctx context.Context, opts *queryOptions, query *idatabase.QueryAny[T], selector any, limit int) (exportRows, bool, error) {
+	if opts.database == nil {
+		// 多取一行用于判断是否截断
+		query.Limit = limit + 1
+		objects, err := query.Select(selector)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated := len(objects) > limit
+		if truncated {
+			objects = objects[:limit]
+		}
+		return &sliceRows[T]{objects: objects}, truncated, nil
+	}
+	collection := opts.database.Collection(query.Collection)
+	total, err := collection.CountDocuments(ctx, mongoFilter(selector), options.Count().SetLimit(int64(limit+1)))
+	if err != nil {
+		return nil, false, err
+	}
+	findOptions := options.Find().SetLimit(int64(limit))
+	if projection := opts.spec.projection(); len(projection) > 0 {
+		findOptions.SetProjection(projection)
+	}
+	if len(query.Sorts) > 0 {
+		findOptions.SetSort(query.Sorts)
+	}
+	cursor, err := collection.Find(ctx, mongoFilter(selector), findOptions)
+	if err != nil {
+		return nil, false, err
+	}
+	return &cursorRows{ctx: ctx, cursor: cursor}, total > int64(limit), nil
+}
+
+type cursorRows struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+}
+
+func (rows *cursorRows) next() (bson.Raw, error) {
+	if rows.cursor.Next(rows.ctx) {
+		return rows.cursor.Current, nil
+	}
+	if err := rows.cursor.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (rows *cursorRows) close() {
+	rows.cursor.Close(context.Background())
+}
+
+type sliceRows[T any] struct {
+	objects []T
+	index   int
+}
+
+func (rows *sliceRows[T]) next() (bson.Raw, error) {
+	if rows.index >= len(rows.objects) {
+		return nil, io.EOF
+	}
+	rows.index++
+	return bson.Marshal(&rows.objects[rows.index-1])
+}
+
+func (rows *sliceRows[T]) close() {}
+
+// exportValue 将字段值转换为单元格
+func exportValue(document bson.Raw, field *QueryField) exportCell {
+	value, err := document.LookupErr(strings.Split(field.Path, ".")...)
+	if err != nil {
+		return exportCell{}
+	}
+	switch value.Type {
+	case bson.TypeString:
+		return exportCell{text: value.StringValue()}
+	case bson.TypeInt32:
+		return exportCell{text: strconv.FormatInt(int64(value.Int32()), 10), number: true}
+	case bson.TypeInt64:
+		return exportCell{text: strconv.FormatInt(value.Int64(), 10), number: true}
+	case bson.TypeDouble:
+		f := value.Double()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return exportCell{text: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		return exportCell{text: strconv.FormatFloat(f, 'f', -1, 64), number: true}
+	case bson.TypeBoolean:
+		return exportCell{text: strconv.FormatBool(value.Boolean())}
+	case bson.TypeDateTime:
+		return exportCell{text: value.Time().UTC().Format(time.RFC3339)}
+	case bson.TypeObjectID:
+		return exportCell{text: value.ObjectID().Hex()}
+	case bson.TypeNull, bson.TypeUndefined:
+		return exportCell{}
+	case bson.TypeDecimal128:
+		return exportCell{text: value.Decimal128().String(), number: true}
+	}
+	// 文档和数组导出为 JSON
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return exportCell{text: value.String()}
+	}
+	text := strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+	return exportCell{text: text}
+}
+
+type csvExport struct {
+	out    io.Writer
+	writer *csv.Writer
+}
+
+func (export *csvExport) header(fields []*QueryField) error {
+	// BOM 使 Excel 以 UTF-8 打开
+	if _, err := io.WriteString(export.out, "\uFEFF"); err != nil {
+		return err
+	}
+	titles := make([]string, len(fields))
+	for i, field := range fields {
+		titles[i] = field.Title
+	}
+	return export.writer.Write(titles)
+}
+
+func (export *csvExport) row(fields []*QueryField, document bson.Raw) error {
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		cell := exportValue(document, field)
+		if !cell.number && cell.text != "" && strings.ContainsRune("=+-@\t\r", rune(cell.text[0])) {
+			// 防止 Excel 将单元格作为公式执行
+			cell.text = "'" + cell.text
+		}
+		record[i] = cell.text
+	}
+	return export.writer.Write(record)
+}
+
+func (export *csvExport) close() error {
+	export.writer.Flush()
+	return export.writer.Error()
+}
+
+type ndjsonExport struct {
+	writer *bufio.Writer
+}
+
+func (export *ndjsonExport) header(fields []*QueryField) error {
+	return nil
+}
+
+func (export *ndjsonExport) row(fields []*QueryField, document bson.Raw) error {
+	line := bson.D{}
+	for _, field := range fields {
+		if value, err := document.LookupErr(strings.Split(field.Path, ".")...); err == nil {
+			line = setPath(line, strings.Split(field.Column, "."), value)
+		}
+	}
+	data, err := bson.MarshalExtJSON(line, false, false)
+	if err != nil {
+		return err
+	}
+	export.writer.Write(data)
+	return export.writer.WriteByte('\n')
+}
+
+func (export *ndjsonExport) close() error {
+	return export.writer.Flush()
+}
+
+// xlsxExport 最简单的 xlsx: 单个工作表, 使用内联字符串
+type xlsxExport struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+func (export *xlsxExport) header(fields []*QueryField) error {
+	parts := [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		w, err := export.zip.Create(part[0])
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, part[1]); err != nil {
+			return err
+		}
+	}
+	// 工作表最后写入, 可以逐行输出
+	w, err := export.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	export.sheet = bufio.NewWriter(w)
+	export.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	export.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	cells := make([]exportCell, len(fields))
+	for i, field := range fields {
+		cells[i] = exportCell{text: field.Title}
+	}
+	return export.writeRow(cells)
+}
+
+func (export *xlsxExport) row(fields []*QueryField, document bson.Raw) error {
+	cells := make([]exportCell, len(fields))
+	for i, field := range fields {
+		cells[i] = exportValue(document, field)
+	}
+	return export.writeRow(cells)
+}
+
+func (export *xlsxExport) writeRow(cells []exportCell) error {
+	export.rows++
+	fmt.Fprintf(export.sheet, `<row r="%d">`, export.rows)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(export.rows)
+		if cell.number {
+			fmt.Fprintf(export.sheet, `<c r="%s"><v>%s</v></c>`, ref, cell.text)
+			continue
+		}
+		fmt.Fprintf(export.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		if err := xml.EscapeText(export.sheet, []byte(xlsxText(cell.text))); err != nil {
+			return err
+		}
+		export.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := export.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (export *xlsxExport) close() error {
+	export.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := export.sheet.Flush(); err != nil {
+		return err
+	}
+	return export.zip.Close()
+}
+
+// xlsxColumn 列序号转列名: 0 -> A, 26 -> AA
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// xlsxText 去掉 XML 1.0 不允许的控制字符
+func xlsxText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, text)
+}
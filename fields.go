@@ -0,0 +1,197 @@
+package apigo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// QueryField 暴露给前端的一个字段
+type QueryField struct {
+	// Column 前端使用的列名
+	Column string
+	// Path bson 路径, 如 profile.city
+	Path string
+	// Type 字段的 Go 类型, 用于转换过滤值
+	Type reflect.Type
+	// Title 导出时的列标题, 取自 title 或 json 标签
+	Title string
+}
+
+// QuerySpec 字段白名单: 只允许按列出的字段排序和过滤, 并只返回这些字段
+type QuerySpec struct {
+	t       reflect.Type
+	columns map[string]*QueryField
+	order   []*QueryField
+}
+
+// QueryFields 由 T 的 bson 标签生成字段白名单
+// columns: "name" 直接暴露 bson 路径, "city=profile.city" 将 bson 路径映射为列名
+// 路径不存在于 T 时 panic
+func QueryFields[T any](columns ...string) *QuerySpec {
+	spec := &QuerySpec{t: reflect.TypeOf((*T)(nil)).Elem(), columns: make(map[string]*QueryField)}
+	for _, column := range columns {
+		name, path, mapped := strings.Cut(column, "=")
+		if !mapped {
+			path = name
+		}
+		ft, sf, ok := bsonField(spec.t, path)
+		if !ok {
+			panic(fmt.Errorf("apigo: field %q not found in %s", path, spec.t))
+		}
+		field := &QueryField{Column: name, Path: path, Type: ft, Title: fieldTitle(sf, name)}
+		spec.columns[name] = field
+		spec.order = append(spec.order, field)
+	}
+	return spec
+}
+
+// defaultQuerySpec 未指定白名单时允许按 T 中的所有字段排序和过滤, 查询只取 T 声明的顶层字段
+func defaultQuerySpec[T any]() *QuerySpec {
+	return &QuerySpec{t: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+// Fields 白名单中的字段, 按声明顺序; 未指定白名单时为 T 的顶层字段
+func (spec *QuerySpec) Fields() []*QueryField {
+	if spec.columns == nil {
+		return topLevelFields(spec.t)
+	}
+	return spec.order
+}
+
+// fieldTitle 列标题: title 标签, 其次 json 标签, 最后为列名
+func fieldTitle(field reflect.StructField, column string) string {
+	if title := field.Tag.Get("title"); title != "" {
+		return title
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return column
+}
+
+// topLevelFields T 的顶层字段, 内联字段展开
+func topLevelFields(t reflect.Type) []*QueryField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []*QueryField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline, ok := bsonFieldName(field)
+		if !ok {
+			continue
+		}
+		if inline {
+			fields = append(fields, topLevelFields(field.Type)...)
+			continue
+		}
+		fields = append(fields, &QueryField{Column: name, Path: name, Type: field.Type, Title: fieldTitle(field, name)})
+	}
+	return fields
+}
+
+// Field 查找列名对应的字段, 不在白名单中时返回错误
+func (spec *QuerySpec) Field(column string) (*QueryField, error) {
+	if spec.columns != nil {
+		if field, ok := spec.columns[column]; ok {
+			return field, nil
+		}
+	} else if strings.HasPrefix(column, "$") {
+		return nil, fmt.Errorf("unknown field %q", column)
+	} else if ft, sf, ok := bsonField(spec.t, column); ok {
+		return &QueryField{Column: column, Path: column, Type: ft, Title: fieldTitle(sf, column)}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q", column)
+}
+
+// projection 查询只取的字段: Fields 及 extra 中的路径, 已包含父路径的子路径不重复列出
+func (spec *QuerySpec) projection(extra ...string) bson.D {
+	var paths []string
+	for _, field := range spec.Fields() {
+		paths = append(paths, field.Path)
+	}
+	paths = append(paths, extra...)
+	// 父路径在前
+	sort.Strings(paths)
+	projection := bson.D{}
+	for _, path := range paths {
+		covered := false
+		for _, included := range projection {
+			if path == included.Key || strings.HasPrefix(path, included.Key+".") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			projection = append(projection, bson.E{Key: path, Value: 1})
+		}
+	}
+	return projection
+}
+
+// projects 是否需要按列名输出
+func (spec *QuerySpec) projects() bool {
+	return spec.columns != nil
+}
+
+// project 只保留白名单字段, 并按列名输出
+func (spec *QuerySpec) project(object any) (bson.D, error) {
+	raw, err := bson.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	document := bson.D{}
+	for _, field := range spec.order {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(field.Path, ".")...)
+		if err != nil {
+			continue
+		}
+		document = setPath(document, strings.Split(field.Column, "."), value)
+	}
+	return document, nil
+}
+
+// projectAll 对结果逐个按列名输出
+func projectAll[T any](spec *QuerySpec, objects []T) (any, error) {
+	if !spec.projects() {
+		if objects == nil {
+			return []T{}, nil
+		}
+		return objects, nil
+	}
+	documents := make([]bson.D, 0, len(objects))
+	for i := range objects {
+		document, err := spec.project(&objects[i])
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+// setPath 按 keys 设置嵌套文档中的值
+func setPath(document bson.D, keys []string, value any) bson.D {
+	for i := range document {
+		if document[i].Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			document[i].Value = value
+		} else if sub, ok := document[i].Value.(bson.D); ok {
+			document[i].Value = setPath(sub, keys[1:], value)
+		}
+		return document
+	}
+	if len(keys) == 1 {
+		return append(document, bson.E{Key: keys[0], Value: value})
+	}
+	return append(document, bson.E{Key: keys[0], Value: setPath(bson.D{}, keys[1:], value)})
+}
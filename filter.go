@@ -0,0 +1,370 @@
+package apigo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	dateTimeType = reflect.TypeOf(primitive.DateTime(0))
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// dateLayouts 过滤值中日期支持的格式
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// bsonFieldName 返回结构体字段在 bson 中的名字, inline 为 true 时字段内联到上级
+func bsonFieldName(field reflect.StructField) (name string, inline bool, ok bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag, hasTag := field.Tag.Lookup("bson")
+	if tag == "-" {
+		return "", false, false
+	}
+	name = strings.ToLower(field.Name)
+	if hasTag {
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		for _, part := range parts[1:] {
+			if part == "inline" {
+				inline = true
+			}
+		}
+	}
+	return name, inline, true
+}
+
+// bsonFieldType 按 bson 路径(如 profile.age)查找字段类型
+func bsonFieldType(t reflect.Type, path string) (reflect.Type, bool) {
+	ft, _, ok := bsonField(t, path)
+	return ft, ok
+}
+
+// bsonField 按 bson 路径查找字段, 路径终点为数组或 map 元素时 field 为零值
+func bsonField(t reflect.Type, path string) (reflect.Type, reflect.StructField, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name, rest, nested := strings.Cut(path, ".")
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			break
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldName, inline, ok := bsonFieldName(field)
+			if !ok {
+				continue
+			}
+			if inline {
+				if ft, sf, ok := bsonField(field.Type, path); ok {
+					return ft, sf, true
+				}
+				continue
+			}
+			if fieldName != name {
+				continue
+			}
+			if !nested {
+				return field.Type, field, true
+			}
+			return bsonField(field.Type, rest)
+		}
+	case reflect.Slice, reflect.Array:
+		// 数组元素的字段, 或数组下标
+		if _, err := strconv.Atoi(name); err == nil {
+			if !nested {
+				return t.Elem(), reflect.StructField{}, true
+			}
+			return bsonField(t.Elem(), rest)
+		}
+		return bsonField(t.Elem(), path)
+	case reflect.Map:
+		if !nested {
+			return t.Elem(), reflect.StructField{}, true
+		}
+		return bsonField(t.Elem(), rest)
+	}
+	return nil, reflect.StructField{}, false
+}
+
+// filterValue 将过滤值转换为字段类型对应的 bson 值, t 为 nil 时保持原值
+func filterValue(t reflect.Type, value any) (any, error) {
+	if t == nil || value == nil {
+		return value, nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.TypeOf(value) == t {
+		return value, nil
+	}
+	switch t {
+	case timeType, dateTimeType:
+		switch v := value.(type) {
+		case string:
+			for _, layout := range dateLayouts {
+				if date, err := time.Parse(layout, v); err == nil {
+					return date, nil
+				}
+			}
+			return nil, fmt.Errorf("invalid date %q", v)
+		case float64:
+			return time.UnixMilli(int64(v)), nil
+		}
+		return nil, fmt.Errorf("invalid date %v", value)
+	case objectIDType:
+		if v, ok := value.(string); ok {
+			return primitive.ObjectIDFromHex(v)
+		}
+		return nil, fmt.Errorf("invalid object id %v", value)
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v := value.(type) {
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+			return nil, fmt.Errorf("invalid number %q", v)
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+			return v, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, ok := value.(string); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", v)
+			}
+			return f, nil
+		}
+	case reflect.Bool:
+		if v, ok := value.(string); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bool %q", v)
+			}
+			return b, nil
+		}
+	case reflect.String:
+		if v, ok := value.(float64); ok {
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+	case reflect.Slice, reflect.Array:
+		// 数组字段按元素匹配
+		if t.Elem().Kind() != reflect.Uint8 {
+			return filterValue(t.Elem(), value)
+		}
+	}
+	return value, nil
+}
+
+// filterValues in 过滤的值, 支持数组或逗号分隔的字符串
+func filterValues(t reflect.Type, value any) ([]any, error) {
+	var items []any
+	switch v := value.(type) {
+	case []any:
+		items = v
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	default:
+		items = []any{v}
+	}
+	values := make([]any, 0, len(items))
+	for _, item := range items {
+		typed, err := filterValue(t, item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, typed)
+	}
+	return values, nil
+}
+
+// filterCondition 将一个过滤条件转换为 MongoDB 查询条件
+// regexLimit: regex 过滤的最大长度, 为 0 时不允许 regex(见 WithRegexFilters)
+func filterCondition(t reflect.Type, field, op string, value any, regexLimit int) (bson.E, error) {
+	if field == "" || strings.HasPrefix(field, "$") {
+		return bson.E{}, fmt.Errorf("invalid filter field %q", field)
+	}
+	switch op {
+	case "empty":
+		return bson.E{Key: field, Value: bson.M{"$in": bson.A{nil, ""}}}, nil
+	case "notempty":
+		return bson.E{Key: field, Value: bson.M{"$nin": bson.A{nil, ""}}}, nil
+	case "notlike":
+		text, ok := value.(string)
+		if !ok {
+			text = fmt.Sprint(value)
+		}
+		return bson.E{Key: field, Value: bson.M{"$not": primitive.Regex{Pattern: regexp.QuoteMeta(text), Options: "i"}}}, nil
+	case "between":
+		values, err := filterValues(t, value)
+		if err != nil || len(values) != 2 {
+			return bson.E{}, fmt.Errorf("filter %s: between needs two values", field)
+		}
+		return bson.E{Key: field, Value: bson.M{"$gte": values[0], "$lte": values[1]}}, nil
+	case "regex":
+		text, ok := value.(string)
+		if !ok {
+			return bson.E{}, fmt.Errorf("filter %s: regex must be a string", field)
+		}
+		if regexLimit <= 0 {
+			return bson.E{}, errRegexFilter
+		}
+		if len(text) > regexLimit {
+			return bson.E{}, fmt.Errorf("filter %s: regex longer than %d", field, regexLimit)
+		}
+		if _, err := regexp.Compile(text); err != nil {
+			return bson.E{}, fmt.Errorf("filter %s: %w", field, err)
+		}
+		return bson.E{Key: field, Value: primitive.Regex{Pattern: text}}, nil
+	case "like", "starts", "ends":
+		text, ok := value.(string)
+		if !ok {
+			text = fmt.Sprint(value)
+		}
+		pattern := regexp.QuoteMeta(text)
+		switch op {
+		case "starts":
+			pattern = "^" + pattern
+		case "ends":
+			pattern = pattern + "$"
+		}
+		return bson.E{Key: field, Value: primitive.Regex{Pattern: pattern, Options: "i"}}, nil
+	case "in":
+		values, err := filterValues(t, value)
+		if err != nil {
+			return bson.E{}, fmt.Errorf("filter %s: %w", field, err)
+		}
+		return bson.E{Key: field, Value: bson.M{"$in": values}}, nil
+	}
+	operator, ok := filterOperators[op]
+	if !ok {
+		return bson.E{}, fmt.Errorf("unsupported filter type %q", op)
+	}
+	typed, err := filterValue(t, value)
+	if err != nil {
+		return bson.E{}, fmt.Errorf("filter %s: %w", field, err)
+	}
+	if operator == "" {
+		return bson.E{Key: field, Value: typed}, nil
+	}
+	return bson.E{Key: field, Value: bson.M{operator: typed}}, nil
+}
+
+var filterOperators = map[string]string{
+	"=":  "",
+	"!=": "$ne",
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+}
+
+// mergeSelector 合并调用方的 selector 与过滤条件, 同一字段的多个条件用 $and 连接
+func mergeSelector(selector any, conditions []bson.E) any {
+	if len(conditions) == 0 {
+		return selector
+	}
+	if selector == nil && len(conditions) == 1 {
+		return bson.D{conditions[0]}
+	}
+	var and bson.A
+	if selector != nil {
+		and = append(and, selector)
+	}
+	for _, condition := range conditions {
+		and = append(and, bson.D{condition})
+	}
+	return bson.M{"$and": and}
+}
+
+// errQuery 请求中的字段、过滤或游标无效
+var errQuery = errors.New("invalid query")
+
+// queryStatus 请求错误返回 400, 其他为 500
+func queryStatus(err error) int {
+	if errors.Is(err, errQuery) || errors.Is(err, errInvalidPage) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// errRegexFilter 未通过 WithRegexFilters 开启 regex 过滤
+var errRegexFilter = errors.New("regex filter is not enabled")
+
+// buildSelector 按白名单将过滤条件转换为 MongoDB 条件并合并到 selector
+func buildSelector(spec *QuerySpec, filters []QueryFilter, selector any, regexLimit int) (any, error) {
+	var conditions []bson.E
+	for _, filter := range filters {
+		condition, err := buildCondition(spec, filter, regexLimit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errQuery, err)
+		}
+		conditions = append(conditions, condition)
+	}
+	return mergeSelector(selector, conditions), nil
+}
+
+func buildCondition(spec *QuerySpec, filter QueryFilter, regexLimit int) (bson.E, error) {
+	if len(filter.Or) > 0 {
+		var or bson.A
+		for _, sub := range filter.Or {
+			if sub.Field == "" {
+				sub.Field = filter.Field
+			}
+			condition, err := buildCondition(spec, sub, regexLimit)
+			if err != nil {
+				return bson.E{}, err
+			}
+			or = append(or, bson.D{condition})
+		}
+		return bson.E{Key: "$or", Value: or}, nil
+	}
+	field, err := spec.Field(filter.Field)
+	if err != nil {
+		return bson.E{}, err
+	}
+	return filterCondition(field.Type, field.Path, filter.Type, filter.Value, regexLimit)
+}
+
+// buildSorts 按白名单将排序转换为 bson 排序
+func buildSorts(spec *QuerySpec, sorters []QuerySort) (bson.D, error) {
+	var sorts bson.D
+	for _, sort := range sorters {
+		field, err := spec.Field(sort.Field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errQuery, err)
+		}
+		sortValue := -1
+		if sort.Dir == "asc" {
+			sortValue = 1
+		}
+		sorts = append(sorts, bson.E{Key: field.Path, Value: sortValue})
+	}
+	return sorts, nil
+}
@@ -0,0 +1,86 @@
+package apigo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type filterProfile struct {
+	City string `bson:"city"`
+}
+
+type filterUser struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Name    string             `bson:"name"`
+	Age     int                `bson:"age"`
+	Active  bool               `bson:"active"`
+	Created time.Time          `bson:"created"`
+	Tags    []string           `bson:"tags"`
+	Profile filterProfile      `bson:"profile"`
+	Secret  string             `bson:"secret"`
+}
+
+func TestBuildSelector(t *testing.T) {
+	id := primitive.NewObjectID()
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	spec := QueryFields[filterUser]("_id", "name", "age", "active", "created", "tags", "city=profile.city")
+	for _, test := range []struct {
+		name       string
+		spec       *QuerySpec
+		filters    []QueryFilter
+		selector   any
+		regexLimit int
+		want       any
+		err        error
+	}{
+		{name: "none", selector: bson.M{"owner": "bob"}, want: bson.M{"owner": "bob"}},
+		{name: "equal number", filters: []QueryFilter{{Field: "age", Type: "=", Value: "30"}}, want: bson.D{{Key: "age", Value: int64(30)}}},
+		{name: "greater", filters: []QueryFilter{{Field: "age", Type: ">", Value: float64(18)}}, want: bson.D{{Key: "age", Value: bson.M{"$gt": int64(18)}}}},
+		{name: "bool", filters: []QueryFilter{{Field: "active", Type: "!=", Value: "true"}}, want: bson.D{{Key: "active", Value: bson.M{"$ne": true}}}},
+		{name: "object id", filters: []QueryFilter{{Field: "_id", Type: "=", Value: id.Hex()}}, want: bson.D{{Key: "_id", Value: id}}},
+		{name: "mapped column", filters: []QueryFilter{{Field: "city", Type: "=", Value: "Paris"}}, want: bson.D{{Key: "profile.city", Value: "Paris"}}},
+		{name: "like quotes", filters: []QueryFilter{{Field: "name", Type: "like", Value: "a.b"}}, want: bson.D{{Key: "name", Value: primitive.Regex{Pattern: `a\.b`, Options: "i"}}}},
+		{name: "starts", filters: []QueryFilter{{Field: "name", Type: "starts", Value: "bo"}}, want: bson.D{{Key: "name", Value: primitive.Regex{Pattern: "^bo", Options: "i"}}}},
+		{name: "in list", filters: []QueryFilter{{Field: "tags", Type: "in", Value: "a, b"}}, want: bson.D{{Key: "tags", Value: bson.M{"$in": []any{"a", "b"}}}}},
+		{name: "between dates", filters: []QueryFilter{{Field: "created", Type: "between", Value: []any{"2024-01-02", "2024-01-03"}}}, want: bson.D{{Key: "created", Value: bson.M{"$gte": day, "$lte": next}}}},
+		{name: "empty", filters: []QueryFilter{{Field: "name", Type: "empty"}}, want: bson.D{{Key: "name", Value: bson.M{"$in": bson.A{nil, ""}}}}},
+		{name: "or", filters: []QueryFilter{{Field: "age", Or: []QueryFilter{{Type: "<", Value: float64(10)}, {Type: ">", Value: float64(60)}}}},
+			want: bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "age", Value: bson.M{"$lt": int64(10)}}}, bson.D{{Key: "age", Value: bson.M{"$gt": int64(60)}}}}}}},
+		{name: "merge selector", selector: bson.M{"owner": "bob"}, filters: []QueryFilter{{Field: "name", Type: "=", Value: "x"}},
+			want: bson.M{"$and": bson.A{bson.M{"owner": "bob"}, bson.D{{Key: "name", Value: "x"}}}}},
+		{name: "regex enabled", regexLimit: 16, filters: []QueryFilter{{Field: "name", Type: "regex", Value: "^b.b$"}}, want: bson.D{{Key: "name", Value: primitive.Regex{Pattern: "^b.b$"}}}},
+		{name: "regex disabled", filters: []QueryFilter{{Field: "name", Type: "regex", Value: "^b"}}, err: errRegexFilter},
+		{name: "regex too long", regexLimit: 2, filters: []QueryFilter{{Field: "name", Type: "regex", Value: "^bob"}}, err: errQuery},
+		{name: "regex invalid", regexLimit: 16, filters: []QueryFilter{{Field: "name", Type: "regex", Value: "(("}}, err: errQuery},
+		{name: "not allowed", filters: []QueryFilter{{Field: "secret", Type: "=", Value: "x"}}, err: errQuery},
+		{name: "operator field", spec: defaultQuerySpec[filterUser](), filters: []QueryFilter{{Field: "$where", Type: "=", Value: "1"}}, err: errQuery},
+		{name: "unknown type", filters: []QueryFilter{{Field: "name", Type: "near", Value: "x"}}, err: errQuery},
+		{name: "invalid number", filters: []QueryFilter{{Field: "age", Type: "=", Value: "old"}}, err: errQuery},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fields := test.spec
+			if fields == nil {
+				fields = spec
+			}
+			got, err := buildSelector(fields, test.filters, test.selector, test.regexLimit)
+			if test.err != nil {
+				if !errors.Is(err, test.err) || !errors.Is(err, errQuery) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("selector %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
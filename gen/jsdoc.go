@@ -0,0 +1,96 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zdypro888/apigo"
+)
+
+// jsTypes 收集 JS 输出中引用的命名结构体, 同名类型加包名区分
+type jsTypes struct {
+	names map[*apigo.TypeInfo]string
+	used  map[string]bool
+	order []*apigo.TypeInfo
+}
+
+func newJSTypes() *jsTypes {
+	return &jsTypes{names: make(map[*apigo.TypeInfo]string), used: make(map[string]bool)}
+}
+
+// Type TypeInfo 对应的 JSDoc 类型, 按 encoding/json 的编码
+func (js *jsTypes) Type(info *apigo.TypeInfo) string {
+	switch info.FullName() {
+	case "time.Time", "go.mongodb.org/mongo-driver/bson/primitive.ObjectID":
+		return "string"
+	case "error":
+		return "Error"
+	}
+	switch info.Kind {
+	case apigo.KindBasic:
+		switch {
+		case info.Basic == "string":
+			return "string"
+		case info.Basic == "bool":
+			return "boolean"
+		}
+		return "number"
+	case apigo.KindPointer:
+		return "?" + js.Type(info.Elem)
+	case apigo.KindSlice, apigo.KindArray:
+		if info.Kind == apigo.KindSlice && info.Elem.Kind == apigo.KindBasic && (info.Elem.Basic == "byte" || info.Elem.Basic == "uint8") {
+			// base64
+			return "string"
+		}
+		return fmt.Sprintf("Array<%s>", js.Type(info.Elem))
+	case apigo.KindMap:
+		return fmt.Sprintf("Object<string, %s>", js.Type(info.Elem))
+	case apigo.KindStruct:
+		if info.Name == "" {
+			var props []string
+			for _, field := range info.Fields {
+				props = append(props, fmt.Sprintf("%s: %s", field.JSONName, js.Type(field.Type)))
+			}
+			return "{" + strings.Join(props, ", ") + "}"
+		}
+		return js.typedef(info)
+	}
+	return "*"
+}
+
+// typedef 命名结构体的 typedef 名称
+func (js *jsTypes) typedef(info *apigo.TypeInfo) string {
+	if name, ok := js.names[info]; ok {
+		return name
+	}
+	name := strings.NewReplacer("[", "_", "]", "", ", ", "_", ".", "_", "*", "").Replace(info.Name)
+	if js.used[name] {
+		name = strings.ReplaceAll(info.PkgPath[strings.LastIndex(info.PkgPath, "/")+1:], ".", "_") + "_" + name
+	}
+	js.names[info] = name
+	js.used[name] = true
+	js.order = append(js.order, info)
+	return name
+}
+
+// Typedefs 所有引用的 typedef, 字段引用的类型在写入时继续收集
+func (js *jsTypes) Typedefs() string {
+	builder := &strings.Builder{}
+	for i := 0; i < len(js.order); i++ {
+		info := js.order[i]
+		var lines []string
+		for _, field := range info.Fields {
+			name := field.JSONName
+			if field.OmitEmpty {
+				name = "[" + name + "]"
+			}
+			lines = append(lines, fmt.Sprintf(" * @property {%s} %s\n", js.Type(field.Type), name))
+		}
+		builder.WriteString(fmt.Sprintf("/** %s\n * @typedef {Object} %s\n", info.FullName(), js.names[info]))
+		for _, line := range lines {
+			builder.WriteString(line)
+		}
+		builder.WriteString(" */\n\n")
+	}
+	return builder.String()
+}
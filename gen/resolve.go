@@ -0,0 +1,168 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"github.com/zdypro888/apigo"
+	"golang.org/x/tools/go/packages"
+)
+
+// typeResolver 将 go/types 中的类型转换为 apigo.TypeInfo
+type typeResolver struct {
+	named map[string]*apigo.TypeInfo
+}
+
+func (r *typeResolver) resolve(typ types.Type) *apigo.TypeInfo {
+	switch value := types.Unalias(typ).(type) {
+	case *types.Named:
+		key := types.TypeString(value, nil)
+		if info, ok := r.named[key]; ok {
+			return info
+		}
+		info := &apigo.TypeInfo{Name: value.Obj().Name()}
+		if pkg := value.Obj().Pkg(); pkg != nil {
+			info.PkgPath = pkg.Path()
+		}
+		if args := value.TypeArgs(); args != nil {
+			var names []string
+			for i := 0; i < args.Len(); i++ {
+				names = append(names, types.TypeString(args.At(i), (*types.Package).Name))
+			}
+			info.Name += "[" + strings.Join(names, ", ") + "]"
+		}
+		// 先放入缓存, 允许递归引用
+		r.named[key] = info
+		underlying := r.resolve(value.Underlying())
+		name, pkgPath := info.Name, info.PkgPath
+		*info = *underlying
+		info.Name, info.PkgPath = name, pkgPath
+		return info
+	case *types.Basic:
+		return &apigo.TypeInfo{Kind: apigo.KindBasic, Basic: value.Name()}
+	case *types.Pointer:
+		return &apigo.TypeInfo{Kind: apigo.KindPointer, Elem: r.resolve(value.Elem())}
+	case *types.Slice:
+		return &apigo.TypeInfo{Kind: apigo.KindSlice, Elem: r.resolve(value.Elem())}
+	case *types.Array:
+		return &apigo.TypeInfo{Kind: apigo.KindArray, Elem: r.resolve(value.Elem()), Len: value.Len()}
+	case *types.Map:
+		return &apigo.TypeInfo{Kind: apigo.KindMap, Key: r.resolve(value.Key()), Elem: r.resolve(value.Elem())}
+	case *types.Chan:
+		return &apigo.TypeInfo{Kind: apigo.KindChan, Elem: r.resolve(value.Elem())}
+	case *types.Signature:
+		return &apigo.TypeInfo{Kind: apigo.KindFunc}
+	case *types.Struct:
+		return &apigo.TypeInfo{Kind: apigo.KindStruct, Fields: r.fields(value)}
+	}
+	// interface 和类型参数
+	return &apigo.TypeInfo{Kind: apigo.KindInterface}
+}
+
+// fields 按 encoding/json 的规则列出字段
+func (r *typeResolver) fields(st *types.Struct) []*apigo.FieldInfo {
+	var fields []*apigo.FieldInfo
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		name, options, _ := strings.Cut(tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if field.Embedded() && name == "" {
+			typ := types.Unalias(field.Type())
+			if pointer, ok := typ.(*types.Pointer); ok {
+				typ = types.Unalias(pointer.Elem())
+			}
+			if embedded, ok := typ.Underlying().(*types.Struct); ok {
+				fields = append(fields, r.fields(embedded)...)
+				continue
+			}
+		}
+		if !field.Exported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		fields = append(fields, &apigo.FieldInfo{
+			Name:      field.Name(),
+			JSONName:  name,
+			OmitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+			Tag:       tag,
+			Type:      r.resolve(field.Type()),
+		})
+	}
+	return fields
+}
+
+// Resolve 通过 go/packages 加载 p.ParseDir 解析的包, 为参数、返回值、流元素和模型填充 Info
+// 按 go list 的规则查找依赖, 支持 replace 和 go.work; 包需要能通过编译
+// 之后 p.WriteJS 使用解析出的类型生成 JSDoc
+func Resolve(p *apigo.Parser) error {
+	config := &packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+		Dir:  p.Dir(),
+	}
+	pkgs, err := packages.Load(config, ".")
+	if err != nil {
+		return err
+	}
+	var pkg *packages.Package
+	for _, loaded := range pkgs {
+		if loaded.Name == p.Pkgname {
+			pkg = loaded
+		}
+	}
+	if pkg == nil {
+		return fmt.Errorf("resolve: package %s not found in %s", p.Pkgname, p.Dir())
+	}
+	if len(pkg.Errors) > 0 {
+		return fmt.Errorf("resolve: %s", pkg.Errors[0])
+	}
+	r := &typeResolver{named: make(map[string]*apigo.TypeInfo)}
+	scope := pkg.Types.Scope()
+	for name, service := range p.Services {
+		obj := scope.Lookup(name)
+		if obj == nil {
+			return fmt.Errorf("resolve: type %s not found", name)
+		}
+		for _, method := range service.Methods {
+			fn, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, method.Name)
+			if fn == nil {
+				return fmt.Errorf("resolve: method %s.%s not found", name, method.Name)
+			}
+			signature := fn.Type().(*types.Signature)
+			params := signature.Params()
+			index := 0
+			for i := 0; i < params.Len(); i++ {
+				info := r.resolve(params.At(i).Type())
+				if i == method.Emitter {
+					// func(T) error 的 T
+					method.StreamInfo = r.resolve(params.At(i).Type().Underlying().(*types.Signature).Params().At(0).Type())
+					continue
+				}
+				if index < len(method.Params) {
+					method.Params[index].Info = info
+				}
+				index++
+			}
+			results := signature.Results()
+			for i := 0; i < results.Len() && i < len(method.Results); i++ {
+				method.Results[i].Info = r.resolve(results.At(i).Type())
+			}
+			if method.Stream != "" && method.Emitter < 0 && len(method.Results) > 0 {
+				method.StreamInfo = method.Results[0].Info.Elem
+			}
+		}
+	}
+	for _, model := range p.Models {
+		if obj := scope.Lookup(model.Name); obj != nil {
+			model.Info = r.resolve(obj.Type())
+		}
+	}
+	p.JSDoc = func() apigo.JSDocTypes { return newJSTypes() }
+	return nil
+}
@@ -1,11 +1,12 @@
 module github.com/zdypro888/apigo
 
-go 1.22
+go 1.22.0
 
 toolchain go1.22.2
 
 require (
 	github.com/anargu/gin-brotli v0.0.0-20220116052358-12bf532d5267
+	github.com/aws/aws-sdk-go v1.45.1
 	github.com/gin-contrib/cors v1.7.2
 	github.com/gin-gonic/autotls v1.1.0
 	github.com/gin-gonic/gin v1.10.0
@@ -17,8 +18,10 @@ require (
 	github.com/zdypro888/net v0.0.0-20240802063416-d3b5b72de0bc
 	github.com/zdypro888/utils v0.0.0-20240731164115-e7aaa690408e
 	go.mongodb.org/mongo-driver v1.16.0
-	golang.org/x/crypto v0.25.0
-	golang.org/x/mod v0.19.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/mod v0.22.0
+	golang.org/x/net v0.34.0
+	golang.org/x/tools v0.29.0
 )
 
 require (
@@ -67,11 +70,9 @@ require (
 	go.uber.org/mock v0.4.0 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56 // indirect
-	golang.org/x/net v0.27.0 // indirect
-	golang.org/x/sync v0.7.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
-	golang.org/x/tools v0.23.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240730163845-b1a4ccb954bf // indirect
 	google.golang.org/grpc v1.65.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
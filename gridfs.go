@@ -0,0 +1,206 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	tusd "github.com/tus/tusd/pkg/handler"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStore 上传过程中写入暂存存储, 完成后转存到 MongoDB GridFS 并删除暂存数据
+// GridFS 文件的 _id 为上传 ID, metadata 中保存 Upload-Metadata
+type GridFSStore struct {
+	bucket  *gridfs.Bucket
+	staging *tusd.StoreComposer
+	lister  TusdLister
+}
+
+// NewGridFSStore 创建 GridFSStore
+// database: 与 idatabase 使用同一连接的数据库, name: GridFS bucket 名称, 为空时为 fs
+// staging: 暂存存储, 需支持删除, 如 filestore.New(dir)
+func NewGridFSStore(database *mongo.Database, name string, staging TusdStore) (*GridFSStore, error) {
+	opts := options.GridFSBucket()
+	if name != "" {
+		opts.SetName(name)
+	}
+	bucket, err := gridfs.NewBucket(database, opts)
+	if err != nil {
+		return nil, err
+	}
+	composer := tusd.NewStoreComposer()
+	staging.UseIn(composer)
+	store := &GridFSStore{bucket: bucket, staging: composer}
+	store.lister = tusdListerOf(staging)
+	return store, nil
+}
+
+func (store *GridFSStore) UseIn(composer *tusd.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseTerminater(store)
+}
+
+type gridfsInfo struct {
+	Size     int64             `bson:"size"`
+	MetaData map[string]string `bson:"metadata,omitempty"`
+}
+
+func (store *GridFSStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	upload, err := store.staging.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	return &gridfsStagingUpload{Upload: upload, store: store}, nil
+}
+
+func (store *GridFSStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	upload, err := store.staging.Core.GetUpload(ctx, id)
+	if err == nil {
+		return &gridfsStagingUpload{Upload: upload, store: store}, nil
+	}
+	cursor, ferr := store.bucket.FindContext(ctx, bson.M{"_id": id})
+	if ferr != nil {
+		return nil, ferr
+	}
+	defer cursor.Close(ctx)
+	if !cursor.Next(ctx) {
+		// 暂存和 GridFS 中都没有, 返回暂存存储的错误(通常为 ErrNotFound)
+		return nil, err
+	}
+	var file gridfs.File
+	if err := cursor.Decode(&file); err != nil {
+		return nil, err
+	}
+	var meta gridfsInfo
+	if file.Metadata != nil {
+		if err := bson.Unmarshal(file.Metadata, &meta); err != nil {
+			return nil, err
+		}
+	}
+	info := tusd.FileInfo{
+		ID:       id,
+		Size:     file.Length,
+		Offset:   file.Length,
+		MetaData: meta.MetaData,
+		Storage:  map[string]string{"Type": "gridfs", "ID": id},
+	}
+	return &gridfsUpload{store: store, info: info}, nil
+}
+
+func (store *GridFSStore) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	switch upload := upload.(type) {
+	case *gridfsUpload:
+		return upload
+	case *gridfsStagingUpload:
+		return upload
+	}
+	return nil
+}
+
+// ListUploads 列出暂存中的上传, 供 janitor 清理
+func (store *GridFSStore) ListUploads(ctx context.Context) ([]TusdUploadEntry, error) {
+	if store.lister == nil {
+		return nil, nil
+	}
+	return store.lister.ListUploads(ctx)
+}
+
+// gridfsStagingUpload 暂存中的上传
+type gridfsStagingUpload struct {
+	tusd.Upload
+	store *GridFSStore
+}
+
+// FinishUpload 转存到 GridFS 后删除暂存数据
+func (upload *gridfsStagingUpload) FinishUpload(ctx context.Context) error {
+	if err := upload.Upload.FinishUpload(ctx); err != nil {
+		return err
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		return err
+	}
+	opts := options.GridFSUpload().SetMetadata(&gridfsInfo{Size: info.Size, MetaData: info.MetaData})
+	err = upload.store.copy(ctx, info.ID, metadataValue(info.MetaData, "filename", "name"), reader, opts)
+	if closer, ok := reader.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	// 已转存到 GridFS, 暂存数据删除失败不影响上传结果
+	if upload.store.staging.UsesTerminater {
+		if err := upload.store.staging.Terminater.AsTerminatableUpload(upload.Upload).Terminate(ctx); err != nil {
+			slog.Error("apigo: gridfs terminate staging", "upload", info.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// copy 写入 GridFS, ctx 结束时停止并删除已写入的分块
+func (store *GridFSStore) copy(ctx context.Context, id, filename string, reader io.Reader, opts *options.UploadOptions) error {
+	stream, err := store.bucket.OpenUploadStreamWithID(id, filename, opts)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetWriteDeadline(deadline)
+	}
+	if _, err = io.Copy(stream, &contextReader{ctx: ctx, reader: reader}); err != nil {
+		stream.Abort()
+		return err
+	}
+	return stream.Close()
+}
+
+func (upload *gridfsStagingUpload) Terminate(ctx context.Context) error {
+	if !upload.store.staging.UsesTerminater {
+		return tusd.ErrNotImplemented
+	}
+	return upload.store.staging.Terminater.AsTerminatableUpload(upload.Upload).Terminate(ctx)
+}
+
+var errGridFSFinished = errors.New("upload is already stored in gridfs")
+
+// gridfsUpload 已转存到 GridFS 的上传
+type gridfsUpload struct {
+	store *GridFSStore
+	info  tusd.FileInfo
+}
+
+func (upload *gridfsUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	return 0, errGridFSFinished
+}
+
+func (upload *gridfsUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	return upload.info, nil
+}
+
+func (upload *gridfsUpload) GetReader(ctx context.Context) (io.Reader, error) {
+	stream, err := upload.store.bucket.OpenDownloadStream(upload.info.ID)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, tusd.ErrNotFound
+	}
+	return stream, err
+}
+
+func (upload *gridfsUpload) FinishUpload(ctx context.Context) error {
+	return nil
+}
+
+func (upload *gridfsUpload) Terminate(ctx context.Context) error {
+	err := upload.store.bucket.DeleteContext(ctx, upload.info.ID)
+	if errors.Is(err, gridfs.ErrFileNotFound) || errors.Is(err, mongo.ErrNoDocuments) {
+		return tusd.ErrNotFound
+	}
+	return err
+}
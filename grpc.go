@@ -0,0 +1,96 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 以下函数供 WriteGrpcServer/WriteGrpcClient 生成的转换代码使用
+
+// ConvertSlice 逐项转换切片, nil 返回 nil
+func ConvertSlice[A, B any](values []A, convert func(A) B) []B {
+	if values == nil {
+		return nil
+	}
+	result := make([]B, len(values))
+	for i, value := range values {
+		result[i] = convert(value)
+	}
+	return result
+}
+
+// ConvertMap 逐项转换 map, nil 返回 nil
+func ConvertMap[K1, K2 comparable, A, B any](values map[K1]A, key func(K1) K2, convert func(A) B) map[K2]B {
+	if values == nil {
+		return nil
+	}
+	result := make(map[K2]B, len(values))
+	for k, value := range values {
+		result[key(k)] = convert(value)
+	}
+	return result
+}
+
+// Deref 取指针的值, nil 返回零值
+func Deref[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
+
+// ObjectIDFromHex proto 中 ObjectID 为 hex 字符串, 无效时返回零值
+func ObjectIDFromHex(hex string) primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(hex)
+	return id
+}
+
+// ErrorCode 方法返回的错误对应的 envelope code, 已知错误按类型, 其它为生成的 handler 使用的 501
+func ErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, context.Canceled):
+		return 499
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusNotImplemented
+}
+
+// GrpcCode 将 envelope 的 code(HTTP 状态码)转换为 gRPC 状态码(codes.Code 的值), 其它 code 为 Unknown
+func GrpcCode(code int) uint32 {
+	switch code {
+	case 0, http.StatusOK:
+		return 0 // OK
+	case 499:
+		return 1 // Canceled
+	case http.StatusBadRequest:
+		return 3 // InvalidArgument
+	case http.StatusGatewayTimeout:
+		return 4 // DeadlineExceeded
+	case http.StatusNotFound:
+		return 5 // NotFound
+	case http.StatusConflict:
+		return 6 // AlreadyExists
+	case http.StatusForbidden:
+		return 7 // PermissionDenied
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return 8 // ResourceExhausted
+	case http.StatusPreconditionFailed:
+		return 9 // FailedPrecondition
+	case http.StatusInternalServerError:
+		return 13 // Internal
+	case http.StatusServiceUnavailable:
+		return 14 // Unavailable
+	case http.StatusUnauthorized:
+		return 16 // Unauthenticated
+	}
+	return 2 // Unknown
+}
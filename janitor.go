@@ -0,0 +1,211 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/pkg/handler"
+)
+
+// TusdUploadEntry 存储中的一个上传
+type TusdUploadEntry struct {
+	ID string
+	// ModTime 最后一次写入的时间
+	ModTime time.Time
+}
+
+// TusdLister 可以列出上传的存储, janitor 据此清理过期上传
+type TusdLister interface {
+	ListUploads(ctx context.Context) ([]TusdUploadEntry, error)
+}
+
+// FileStoreLister 列出 filestore 目录中的上传
+type FileStoreLister struct {
+	Path string
+}
+
+func (lister FileStoreLister) ListUploads(ctx context.Context) ([]TusdUploadEntry, error) {
+	entries, err := os.ReadDir(lister.Path)
+	if err != nil {
+		return nil, err
+	}
+	var uploads []TusdUploadEntry
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		modTime := info.ModTime()
+		if stat, err := os.Stat(filepath.Join(lister.Path, id)); err == nil && stat.ModTime().After(modTime) {
+			modTime = stat.ModTime()
+		}
+		uploads = append(uploads, TusdUploadEntry{ID: id, ModTime: modTime})
+	}
+	return uploads, nil
+}
+
+// WithTusdExpiration 未完成的上传在最后一次写入 ttl 后过期删除, 并向客户端声明 expiration 扩展
+func WithTusdExpiration(ttl time.Duration) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.expiration = ttl
+	}
+}
+
+// WithTusdDeleteConsumed TusdHandle 处理成功后删除上传
+func WithTusdDeleteConsumed() TusdHandleOption {
+	return func(options *tusdHandleOptions) {
+		options.deleteConsumed = true
+	}
+}
+
+type tusdJanitor struct {
+	composer *tusd.StoreComposer
+	lister   TusdLister
+	policy   *tusdPolicy
+	ttl      time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func (j *tusdJanitor) run() {
+	interval := min(max(j.ttl/2, time.Second), time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			if err := j.sweep(context.Background()); err != nil {
+				slog.Error("apigo: tus janitor", "error", err)
+			}
+		}
+	}
+}
+
+func (j *tusdJanitor) close() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+}
+
+// sweep 删除过期的未完成上传
+func (j *tusdJanitor) sweep(ctx context.Context) error {
+	entries, err := j.lister.ListUploads(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-j.ttl)
+	for _, entry := range entries {
+		if entry.ModTime.After(deadline) {
+			continue
+		}
+		if err := j.expire(ctx, entry.ID); err != nil {
+			slog.Error("apigo: tus janitor terminate", "upload", entry.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// expire 持有上传锁时检查并删除未完成的上传, 正在写入的上传跳过
+func (j *tusdJanitor) expire(ctx context.Context, id string) error {
+	lock, err := tusdLock(j.composer, id)
+	if errors.Is(err, tusd.ErrFileLocked) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	upload, err := j.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil || (!info.SizeIsDeferred && info.Offset == info.Size) {
+		return nil
+	}
+	if err := tusdTerminate(ctx, j.composer, upload); err != nil {
+		return err
+	}
+	j.policy.release(id)
+	return nil
+}
+
+// tusdLock 获取上传锁, 与 tusd 处理请求使用同一个 Locker
+func tusdLock(composer *tusd.StoreComposer, id string) (tusd.Lock, error) {
+	lock, err := composer.Locker.NewLock(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = lock.Lock(); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// tusdTerminate 删除上传, 调用方需持有上传锁
+func tusdTerminate(ctx context.Context, composer *tusd.StoreComposer, upload tusd.Upload) error {
+	if !composer.UsesTerminater {
+		return tusd.ErrNotImplemented
+	}
+	return composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx)
+}
+
+// tusdExpiresWriter 声明 expiration 扩展并为未完成的上传返回 Upload-Expires
+type tusdExpiresWriter struct {
+	gin.ResponseWriter
+	request  *http.Request
+	composer *tusd.StoreComposer
+	ttl      time.Duration
+}
+
+func (w *tusdExpiresWriter) WriteHeader(code int) {
+	header := w.Header()
+	if extensions := header.Get("Tus-Extension"); extensions != "" {
+		header.Set("Tus-Extension", extensions+",expiration")
+	}
+	if w.incomplete(code) {
+		header.Set("Upload-Expires", time.Now().Add(w.ttl).UTC().Format(http.TimeFormat))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *tusdExpiresWriter) incomplete(code int) bool {
+	var id string
+	switch {
+	case w.request.Method == http.MethodPost && code == http.StatusCreated:
+		id = path.Base(w.Header().Get("Location"))
+	case w.request.Method == http.MethodPatch && code == http.StatusNoContent:
+		id = path.Base(w.request.URL.Path)
+	default:
+		return false
+	}
+	ctx := w.request.Context()
+	upload, err := w.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return false
+	}
+	info, err := upload.GetInfo(ctx)
+	return err == nil && (info.SizeIsDeferred || info.Offset < info.Size)
+}
+
+// Close 停止 Server 的后台任务, 之后上传入口返回 503
+func (s *Server) Close() error {
+	for _, endpoint := range s.tusdEndpoints {
+		endpoint.close()
+	}
+	return nil
+}
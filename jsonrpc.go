@@ -0,0 +1,203 @@
+package apigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON-RPC 2.0 错误码
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// JSONRPCServerError 接口返回的错误, error.data.code 为 envelope code 或 HTTP 状态码
+	JSONRPCServerError = -32000
+)
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// notification 没有 id 的请求不返回结果
+func (request *jsonrpcRequest) notification() bool {
+	return request.ID == nil
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcErrorData 接口错误的 error.data
+type jsonrpcErrorData struct {
+	Code      int    `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// jsonrpcErrorCode envelope code 对应的 JSON-RPC 错误码
+// 400 为 JSONRPCInvalidParams, 其他(包括接口返回的 404)为 JSONRPCServerError
+// JSONRPCMethodNotFound 只用于未注册的 Service.Method
+func jsonrpcErrorCode(code int) int {
+	if code == http.StatusBadRequest {
+		return JSONRPCInvalidParams
+	}
+	return JSONRPCServerError
+}
+
+// HandleJSONRPC 在 path 注册 JSON-RPC 2.0 接口, method 为 Service.Method
+// params 可为对象(按参数名)或数组(按 WithParams 的顺序), 支持批量和通知(无 id)
+// 接口返回的错误见 jsonrpcErrorCode, error.data 为 {code, request_id}
+// concurrency: 批量时同时执行的最大调用数, <= 0 时为 1
+func (s *Server) HandleJSONRPC(path string, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	s.App.POST(path, func(ctx *gin.Context) {
+		ctx.Set(codeKey, 0)
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.JSON(http.StatusOK, &jsonrpcResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: JSONRPCParseError, Message: err.Error()}, ID: json.RawMessage("null")})
+			return
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			var requests []json.RawMessage
+			if err := json.Unmarshal(body, &requests); err != nil {
+				ctx.JSON(http.StatusOK, &jsonrpcResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: JSONRPCParseError, Message: err.Error()}, ID: json.RawMessage("null")})
+				return
+			}
+			if len(requests) == 0 || len(requests) > MaxBatchSize {
+				ctx.JSON(http.StatusOK, &jsonrpcResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: JSONRPCInvalidRequest, Message: fmt.Sprintf("batch size must be 1 to %d", MaxBatchSize)}, ID: json.RawMessage("null")})
+				return
+			}
+			responses := make([]*jsonrpcResponse, len(requests))
+			runLimited(len(requests), concurrency, func(i int) {
+				responses[i] = s.serveJSONRPC(ctx, requests[i])
+			})
+			var results []*jsonrpcResponse
+			for _, response := range responses {
+				if response != nil {
+					results = append(results, response)
+				}
+			}
+			if len(results) == 0 {
+				ctx.Status(http.StatusNoContent)
+				return
+			}
+			ctx.JSON(http.StatusOK, results)
+			return
+		}
+		if response := s.serveJSONRPC(ctx, body); response != nil {
+			ctx.JSON(http.StatusOK, response)
+		} else {
+			ctx.Status(http.StatusNoContent)
+		}
+	})
+}
+
+// serveJSONRPC 执行一个请求, 通知返回 nil
+func (s *Server) serveJSONRPC(ctx *gin.Context, data json.RawMessage) *jsonrpcResponse {
+	var request jsonrpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		var syntax *json.SyntaxError
+		code := JSONRPCInvalidRequest
+		if errors.As(err, &syntax) {
+			code = JSONRPCParseError
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: code, Message: err.Error()}, ID: json.RawMessage("null")}
+	}
+	response := &jsonrpcResponse{JSONRPC: "2.0", ID: request.ID}
+	if response.ID == nil {
+		response.ID = json.RawMessage("null")
+	}
+	fail := func(code int, message string, data any) *jsonrpcResponse {
+		if request.notification() {
+			return nil
+		}
+		response.Error = &jsonrpcError{Code: code, Message: message, Data: data}
+		return response
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		// 无效请求无法判断是否为通知, 总是返回
+		response.Error = &jsonrpcError{Code: JSONRPCInvalidRequest, Message: "invalid request"}
+		return response
+	}
+	method, path, ok := s.lookupCall(request.Method)
+	if !ok {
+		return fail(JSONRPCMethodNotFound, fmt.Sprintf("method %q not found", request.Method), nil)
+	}
+	body, err := jsonrpcParams(s.apis[method+" "+path], request.Params)
+	if err != nil {
+		return fail(JSONRPCInvalidParams, err.Error(), nil)
+	}
+	header := ctx.Request.Header.Clone()
+	header.Del(RequestIDHeader)
+	status, envelope := s.dispatch(ctx.Request.Context(), method, path, header, ctx.Request, body)
+	if status != http.StatusOK || envelope == nil {
+		code, message := dispatchCode(status)
+		return fail(jsonrpcErrorCode(code), message, &jsonrpcErrorData{Code: code})
+	}
+	var msg batchResponse
+	if err := json.Unmarshal(envelope, &msg); err != nil {
+		return fail(JSONRPCInternalError, err.Error(), nil)
+	}
+	if msg.Code != 0 {
+		return fail(jsonrpcErrorCode(msg.Code), msg.Error, &jsonrpcErrorData{Code: msg.Code, RequestID: msg.RequestID})
+	}
+	if request.notification() {
+		return nil
+	}
+	response.Result = msg.Data
+	if response.Result == nil {
+		response.Result = json.RawMessage("null")
+	}
+	return response
+}
+
+// jsonrpcParams 将 params 转换为请求体, 数组按参数名转换为对象
+func jsonrpcParams(api *APIMethod, params json.RawMessage) ([]byte, error) {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil, nil
+	}
+	switch params[0] {
+	case '{':
+		return params, nil
+	case '[':
+		var values []json.RawMessage
+		if err := json.Unmarshal(params, &values); err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, nil
+		}
+		if len(values) > len(api.Params) {
+			return nil, fmt.Errorf("too many params: want %d, got %d", len(api.Params), len(values))
+		}
+		object := make(map[string]json.RawMessage, len(values))
+		for i, value := range values {
+			object[api.Params[i]] = value
+		}
+		return json.Marshal(object)
+	}
+	return nil, fmt.Errorf("params must be an object or array")
+}
@@ -0,0 +1,165 @@
+package apigo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newJSONRPCServer(t *testing.T, touched *atomic.Int32) *Server {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(func() { s.Close() })
+	s.WithBSON = false
+	type addRequest struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	s.HandleAPI(http.MethodPost, "Math", "Add", "/api/Math/Add", func(ctx *gin.Context) {
+		req, err := ReadMessage[addRequest](s, ctx)
+		if err != nil {
+			s.ResponseError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		s.ResponseData(ctx, req.A+req.B)
+	}, WithParams("a", "b"))
+	for name, code := range map[string]int{"Missing": http.StatusNotFound, "Limited": http.StatusTooManyRequests, "Broken": http.StatusInternalServerError, "Invalid": http.StatusBadRequest} {
+		code := code
+		s.HandleAPI(http.MethodGet, "Math", name, "/api/Math/"+name, func(ctx *gin.Context) {
+			s.ResponseError(ctx, code, errors.New(http.StatusText(code)))
+		})
+	}
+	s.HandleAPI(http.MethodGet, "Math", "Touch", "/api/Math/Touch", func(ctx *gin.Context) {
+		touched.Add(1)
+		s.ResponseData(ctx, nil)
+	})
+	s.HandleJSONRPC("/rpc", 2)
+	return s
+}
+
+func postJSONRPC(s *Server, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	s.App.ServeHTTP(recorder, request)
+	return recorder
+}
+
+type jsonrpcTestResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+		Data *struct {
+			Code int `json:"code"`
+		} `json:"data"`
+	} `json:"error"`
+	ID json.RawMessage `json:"id"`
+}
+
+func TestJSONRPCErrorMapping(t *testing.T) {
+	var touched atomic.Int32
+	s := newJSONRPCServer(t, &touched)
+	for _, test := range []struct {
+		name     string
+		body     string
+		result   string
+		code     int
+		dataCode int
+	}{
+		{name: "named params", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Add","params":{"a":1,"b":2}}`, result: "3"},
+		{name: "positional params", body: `{"jsonrpc":"2.0","id":"x","method":"Math.Add","params":[4,5]}`, result: "9"},
+		{name: "too many params", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Add","params":[1,2,3]}`, code: JSONRPCInvalidParams},
+		{name: "unknown method", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Sub"}`, code: JSONRPCMethodNotFound},
+		{name: "application not found", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Missing"}`, code: JSONRPCServerError, dataCode: http.StatusNotFound},
+		{name: "rate limited", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Limited"}`, code: JSONRPCServerError, dataCode: http.StatusTooManyRequests},
+		{name: "server error", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Broken"}`, code: JSONRPCServerError, dataCode: http.StatusInternalServerError},
+		{name: "bad request", body: `{"jsonrpc":"2.0","id":1,"method":"Math.Invalid"}`, code: JSONRPCInvalidParams, dataCode: http.StatusBadRequest},
+		{name: "wrong version", body: `{"jsonrpc":"1.0","id":1,"method":"Math.Add"}`, code: JSONRPCInvalidRequest},
+		{name: "parse error", body: `{"jsonrpc":`, code: JSONRPCParseError},
+		{name: "empty batch", body: `[]`, code: JSONRPCInvalidRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := postJSONRPC(s, test.body)
+			var response jsonrpcTestResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response %s: %v", recorder.Body, err)
+			}
+			if test.code == 0 {
+				if response.Error != nil || string(response.Result) != test.result {
+					t.Fatalf("response %s, want result %s", recorder.Body, test.result)
+				}
+				return
+			}
+			if response.Error == nil || response.Error.Code != test.code {
+				t.Fatalf("response %s, want code %d", recorder.Body, test.code)
+			}
+			if test.dataCode != 0 && (response.Error.Data == nil || response.Error.Data.Code != test.dataCode) {
+				t.Fatalf("response %s, want data.code %d", recorder.Body, test.dataCode)
+			}
+		})
+	}
+}
+
+func TestJSONRPCNotifications(t *testing.T) {
+	var touched atomic.Int32
+	s := newJSONRPCServer(t, &touched)
+	for _, test := range []struct {
+		name    string
+		body    string
+		status  int
+		ids     []string
+		touched int32
+	}{
+		{name: "notification", body: `{"jsonrpc":"2.0","method":"Math.Touch"}`, status: http.StatusNoContent, touched: 1},
+		{name: "failed notification", body: `{"jsonrpc":"2.0","method":"Math.Missing"}`, status: http.StatusNoContent},
+		{name: "unknown notification", body: `{"jsonrpc":"2.0","method":"Math.Sub"}`, status: http.StatusNoContent},
+		{name: "null id is a call", body: `{"jsonrpc":"2.0","id":null,"method":"Math.Touch"}`, status: http.StatusOK, ids: []string{"null"}, touched: 1},
+		{name: "batch of notifications", body: `[{"jsonrpc":"2.0","method":"Math.Touch"},{"jsonrpc":"2.0","method":"Math.Touch"}]`, status: http.StatusNoContent, touched: 2},
+		{name: "mixed batch", body: `[{"jsonrpc":"2.0","method":"Math.Touch"},{"jsonrpc":"2.0","id":1,"method":"Math.Add","params":[1,1]},{"jsonrpc":"2.0","id":2,"method":"Math.Sub"}]`,
+			status: http.StatusOK, ids: []string{"1", "2"}, touched: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			touched.Store(0)
+			recorder := postJSONRPC(s, test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if got := touched.Load(); got != test.touched {
+				t.Fatalf("touched %d, want %d", got, test.touched)
+			}
+			if test.status == http.StatusNoContent {
+				if recorder.Body.Len() != 0 {
+					t.Fatalf("body %s, want empty", recorder.Body)
+				}
+				return
+			}
+			body := strings.TrimSpace(recorder.Body.String())
+			var responses []jsonrpcTestResponse
+			if strings.HasPrefix(body, "[") {
+				if err := json.Unmarshal([]byte(body), &responses); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var response jsonrpcTestResponse
+				if err := json.Unmarshal([]byte(body), &response); err != nil {
+					t.Fatal(err)
+				}
+				responses = append(responses, response)
+			}
+			if len(responses) != len(test.ids) {
+				t.Fatalf("responses %s, want ids %v", body, test.ids)
+			}
+			for i, response := range responses {
+				if string(response.ID) != test.ids[i] {
+					t.Fatalf("response %d id %s, want %s", i, response.ID, test.ids[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package apigo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 请求 ID 头
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	requestIDKey = "apigo.request_id"
+	codeKey      = "apigo.code"
+)
+
+type requestIDContextKey struct{}
+
+// NewRequestID 生成随机请求 ID
+func NewRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// WithRequestID 将请求 ID 附加到 context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext 读取 context 中的请求 ID
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// outgoingRequestID 客户端请求使用的 ID, ctx 中已有请求 ID 时沿用
+func outgoingRequestID(ctx context.Context) string {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return id
+	}
+	return NewRequestID()
+}
+
+// RequestID 返回当前请求的 ID
+func RequestID(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
+
+// requestID 接收或生成 X-Request-ID, 并写入 context 和响应头
+func (s *Server) requestID(ctx *gin.Context) {
+	id := ctx.GetHeader(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = NewRequestID()
+	}
+	ctx.Set(requestIDKey, id)
+	ctx.Request = ctx.Request.WithContext(WithRequestID(ctx.Request.Context(), id))
+	ctx.Header(RequestIDHeader, id)
+	ctx.Next()
+}
+
+// accessLog 使用 log/slog 输出结构化访问日志
+func (s *Server) accessLog(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	route := ctx.FullPath()
+	if route == "" {
+		route = ctx.Request.URL.Path
+	}
+	attrs := []slog.Attr{
+		slog.String("request_id", RequestID(ctx)),
+		slog.String("method", ctx.Request.Method),
+		slog.String("route", route),
+		slog.Int("status", ctx.Writer.Status()),
+		slog.Duration("latency", time.Since(start)),
+		slog.Int("bytes", ctx.Writer.Size()),
+		slog.String("protocol", protocolName(ctx.Request.ProtoMajor, ctx.Request.Proto)),
+		slog.String("client_ip", ctx.ClientIP()),
+	}
+	if code, ok := ctx.Get(codeKey); ok {
+		attrs = append(attrs, slog.Any("code", code))
+	}
+	if span := SpanFromContext(ctx.Request.Context()); span != nil {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID))
+	}
+	level := slog.LevelInfo
+	if len(ctx.Errors) > 0 {
+		attrs = append(attrs, slog.String("errors", ctx.Errors.String()))
+		level = slog.LevelError
+	}
+	logger.LogAttrs(ctx.Request.Context(), level, "apigo: access", attrs...)
+}
+
+func protocolName(major int, proto string) string {
+	switch major {
+	case 3:
+		return "h3"
+	case 2:
+		return "h2"
+	}
+	return strings.ToLower(proto)
+}
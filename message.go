@@ -1,8 +1,9 @@
 package apigo
 
 type messageBase struct {
-	Code  int    `json:"code" bson:"code"`
-	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	Code      int    `json:"code" bson:"code"`
+	Error     string `json:"error,omitempty" bson:"error,omitempty"`
+	RequestID string `json:"request_id,omitempty" bson:"request_id,omitempty"`
 }
 
 type message[T any] struct {
@@ -10,3 +11,16 @@ type message[T any] struct {
 	Error string `json:"error,omitempty" bson:"error,omitempty"`
 	Data  T      `json:"data,omitempty" bson:"data,omitempty"`
 }
+
+// envelope 返回消息中的 code
+type envelope interface {
+	envelopeCode() int
+}
+
+func (msg *messageBase) envelopeCode() int {
+	return msg.Code
+}
+
+func (msg *message[T]) envelopeCode() int {
+	return msg.Code
+}
@@ -0,0 +1,214 @@
+package apigo
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultBuckets 默认延迟分桶(秒), 与 Prometheus 客户端一致
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricSeries struct {
+	values  []string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+func newMetricFamily(name, help, kind string, buckets []float64, labels ...string) *metricFamily {
+	return &metricFamily{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+func (f *metricFamily) get(values ...string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{values: values}
+		if f.kind == "histogram" {
+			series.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = series
+	}
+	return series
+}
+
+func (f *metricFamily) observe(v float64, values ...string) {
+	series := f.get(values...)
+	for i, le := range f.buckets {
+		if v <= le {
+			series.buckets[i]++
+		}
+	}
+	series.sum += v
+	series.count++
+}
+
+func (f *metricFamily) labelString(values []string, extra ...string) string {
+	var parts []string
+	for i, name := range f.labels {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (f *metricFamily) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(series.values), formatFloat(series.value))
+			continue
+		}
+		for i, le := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(series.values, "le", formatFloat(le)), series.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(series.values, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(series.values), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(series.values), series.count)
+	}
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Metrics 服务端及客户端请求指标, 以 Prometheus 文本格式输出
+type Metrics struct {
+	mu             sync.Mutex
+	serverRequests *metricFamily
+	serverDuration *metricFamily
+	clientRequests *metricFamily
+	clientDuration *metricFamily
+}
+
+// NewMetrics 创建指标集合, buckets 为空时使用 DefaultBuckets
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Metrics{
+		serverRequests: newMetricFamily("apigo_requests_total", "Total number of handled requests.", "counter", nil, "service", "method", "route", "status", "code"),
+		serverDuration: newMetricFamily("apigo_request_duration_seconds", "Latency of handled requests.", "histogram", buckets, "service", "method", "route"),
+		clientRequests: newMetricFamily("apigo_client_requests_total", "Total number of client requests.", "counter", nil, "path", "method", "code"),
+		clientDuration: newMetricFamily("apigo_client_request_duration_seconds", "Latency of client requests.", "histogram", buckets, "path", "method"),
+	}
+}
+
+// ObserveServer 记录一次服务端请求, code 为空表示没有返回消息
+func (m *Metrics) ObserveServer(api *APIMethod, route string, status int, code string, duration time.Duration) {
+	var service, method string
+	if api != nil {
+		service, method = api.Service, api.Method
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.serverRequests.get(service, method, route, strconv.Itoa(status), code).value++
+	m.serverDuration.observe(duration.Seconds(), service, method, route)
+}
+
+// ObserveRequest 实现 ClientMetrics
+func (m *Metrics) ObserveRequest(path, method string, code int, err error, duration time.Duration) {
+	codeLabel := strconv.Itoa(code)
+	if err != nil {
+		codeLabel = "error"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clientRequests.get(path, method, codeLabel).value++
+	m.clientDuration.observe(duration.Seconds(), path, method)
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	builder := &strings.Builder{}
+	m.mu.Lock()
+	for _, family := range []*metricFamily{m.serverRequests, m.serverDuration, m.clientRequests, m.clientDuration} {
+		if len(family.series) > 0 {
+			family.write(builder)
+		}
+	}
+	m.mu.Unlock()
+	n, err := io.WriteString(w, builder.String())
+	return int64(n), err
+}
+
+// ServeHTTP 输出指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// ClientMetrics 客户端指标钩子, 每次请求完成后调用
+type ClientMetrics interface {
+	ObserveRequest(path, method string, code int, err error, duration time.Duration)
+}
+
+// EnableMetrics 开启服务端指标并在 path 提供 /metrics 接口(path 为空时使用 /metrics)
+func (s *Server) EnableMetrics(path string) *Metrics {
+	if path == "" {
+		path = "/metrics"
+	}
+	s.metrics = NewMetrics()
+	s.App.GET(path, gin.WrapH(s.metrics))
+	return s.metrics
+}
+
+// observeMetrics 记录请求指标
+func (s *Server) observeMetrics(ctx *gin.Context) {
+	if s.metrics == nil {
+		ctx.Next()
+		return
+	}
+	start := time.Now()
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		// 未匹配路由不单独计数, 避免标签膨胀
+		route = "unmatched"
+	}
+	var code string
+	if value, ok := ctx.Get(codeKey); ok {
+		code = fmt.Sprint(value)
+	}
+	s.metrics.ObserveServer(s.LookupAPI(ctx), route, ctx.Writer.Status(), code, time.Since(start))
+}
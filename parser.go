@@ -1,13 +1,17 @@
 package apigo
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +25,8 @@ const (
 type NameType struct {
 	Name string
 	Type string
+	// Info gen.Resolve 后的类型结构
+	Info *TypeInfo
 }
 
 type FuncDecl struct {
@@ -29,32 +35,84 @@ type FuncDecl struct {
 	Recv    NameType
 	Params  []*NameType
 	Results []*NameType
+	// Options @api 指令中的 key=value 选项
+	Options map[string]string
 
 	LastResultIndex int
 	HasNormalResult bool
 	LastResultError bool
+	// Stream SSE 流的元素类型, 方法返回 <-chan T 或接收 func(T) error 参数时不为空
+	Stream string
+	// Emitter func(T) error 参数的位置(已从 Params 中移除), 返回 channel 时为 -1
+	Emitter int
+	// StreamInfo gen.Resolve 后流元素的类型结构
+	StreamInfo *TypeInfo
 }
 
-func (method *FuncDecl) Init() {
+func (method *FuncDecl) Init() error {
 	method.LastResultIndex = len(method.Results) - 1
 	method.HasNormalResult = method.LastResultIndex >= 0 && method.Results[0].Type != "error"
 	method.LastResultError = method.LastResultIndex >= 0 && method.Results[method.LastResultIndex].Type == "error"
+	method.Emitter = -1
+	for i, param := range method.Params {
+		if elem, ok := emitterType(param.Type); ok {
+			if method.Stream != "" || method.HasNormalResult {
+				return fmt.Errorf("%s: emitter method must return nothing or error", method.Name)
+			}
+			method.Stream = elem
+			method.Emitter = i
+		}
+	}
+	if method.Emitter >= 0 {
+		method.Params = append(method.Params[:method.Emitter:method.Emitter], method.Params[method.Emitter+1:]...)
+		return nil
+	}
+	if method.HasNormalResult {
+		if elem, ok := strings.CutPrefix(method.Results[0].Type, "<-chan "); ok {
+			if len(method.Results) > 2 || (len(method.Results) == 2 && !method.LastResultError) {
+				return fmt.Errorf("%s: stream method must return (<-chan T) or (<-chan T, error)", method.Name)
+			}
+			method.Stream = elem
+			method.HasNormalResult = false
+		}
+	}
+	return nil
+}
+
+// emitterType 参数类型为 func(T) error 时返回 T
+func emitterType(typ string) (string, bool) {
+	if elem, ok := strings.CutPrefix(typ, "func("); ok {
+		if elem, ok = strings.CutSuffix(elem, ") error"); ok && elem != "" && !strings.Contains(elem, ",") {
+			return elem, true
+		}
+	}
+	return "", false
 }
 
 func (method *FuncDecl) WriteRR(builder *strings.Builder) {
+	method.writeRR(builder, "Request", "Response", "")
+}
+
+// writeRR 生成请求和响应结构, call 不为空时为导出类型生成注释
+func (method *FuncDecl) writeRR(builder *strings.Builder, requestName, responseName, call string) {
 	if len(method.Params) > 0 {
 		// Generate request struct to hold params
-		builder.WriteString("type Request struct {\n")
+		if call != "" {
+			builder.WriteString(fmt.Sprintf("// %s %s 的请求\n", requestName, call))
+		}
+		builder.WriteString(fmt.Sprintf("type %s struct {\n", requestName))
 		for _, param := range method.Params {
 			builder.WriteString(fmt.Sprintf("\t%s %s `json:\"%s\" bson:\"%s\"`\n", GoCamelCase(param.Name), param.Type, param.Name, param.Name))
 		}
 		builder.WriteString("}\n")
 	}
 	resultLastIndex := len(method.Results) - 1
-	hastNormalResult := resultLastIndex >= 0 && method.Results[0].Type != "error"
-	if hastNormalResult {
+	if method.HasNormalResult {
 		// Generate response struct to hold results
-		builder.WriteString("type Response struct {\n")
+		if call != "" {
+			builder.WriteString(fmt.Sprintf("// %s %s 的响应\n", responseName, call))
+		}
+		builder.WriteString(fmt.Sprintf("type %s struct {\n", responseName))
 		for i, ret := range method.Results {
 			if i == resultLastIndex && ret.Type == "error" {
 				break
@@ -70,27 +128,55 @@ type Service struct {
 	Methods []*FuncDecl
 }
 
+// Model "// @api crud collection=users" 标注的结构体, 生成 CRUD 接口
+type Model struct {
+	Name       string
+	Collection string
+	// IDType bson _id 字段的类型, 没有时为 any
+	IDType  string
+	Options map[string]string
+	Doc     *ast.CommentGroup
+	// Info gen.Resolve 后的类型结构
+	Info *TypeInfo
+}
+
 type Parser struct {
 	fileset  *token.FileSet
 	Services map[string]*Service
+	Models   []*Model
 	Pkgname  string
 
-	copySpecs []ast.Spec
+	copySpecs   []ast.Spec
+	copyImports map[string]string
+	// types 包中所有类型声明, 生成 proto 时解析结构体
+	types map[string]*ast.TypeSpec
+	// dir ParseDir 的目录, gen.Resolve 时加载
+	dir string
+	// JSDoc 不为空时 WriteJS 使用解析出的类型, 由 gen.Resolve 设置
+	JSDoc func() JSDocTypes
 }
 
 func NewParser() *Parser {
 	parser := &Parser{
-		fileset:  token.NewFileSet(),
-		Services: make(map[string]*Service),
+		fileset:     token.NewFileSet(),
+		Services:    make(map[string]*Service),
+		copyImports: make(map[string]string),
+		types:       make(map[string]*ast.TypeSpec),
 	}
 	return parser
 }
 
+// Dir ParseDir 解析的目录
+func (p *Parser) Dir() string {
+	return p.dir
+}
+
 func (p *Parser) ParseDir(path string) error {
 	packages, err := parser.ParseDir(p.fileset, path, nil, parser.ParseComments)
 	if err != nil {
 		return err
 	}
+	p.dir = path
 	for name, pkg := range packages {
 		p.Pkgname = name
 		for _, file := range pkg.Files {
@@ -103,12 +189,23 @@ func (p *Parser) ParseDir(path string) error {
 						}
 					}
 				case *ast.GenDecl:
+					if value.Tok == token.TYPE {
+						for _, spec := range value.Specs {
+							if spec, ok := spec.(*ast.TypeSpec); ok {
+								p.types[spec.Name.Name] = spec
+							}
+						}
+					}
 					if value.Doc != nil {
 						switch value.Tok {
 						case token.TYPE:
 							for _, comment := range value.Doc.List {
 								if strings.Contains(comment.Text, "@api") {
 									p.copySpecs = append(p.copySpecs, value.Specs...)
+									p.addCopyImports(file, value)
+									if err := p.parseModel(value, comment.Text); err != nil {
+										return err
+									}
 								}
 							}
 						}
@@ -172,13 +269,60 @@ func (p *Parser) exprToString(typ ast.Expr) (string, error) {
 		} else {
 			return "", fmt.Errorf("not support selector type %T", value.X)
 		}
+	case *ast.ChanType:
+		val, err := p.exprToString(value.Value)
+		if err != nil {
+			return "", err
+		}
+		switch value.Dir {
+		case ast.RECV:
+			return fmt.Sprintf("<-chan %s", val), nil
+		case ast.SEND:
+			return fmt.Sprintf("chan<- %s", val), nil
+		}
+		return fmt.Sprintf("chan %s", val), nil
 	case *ast.FuncType:
-		return "", nil
+		return p.funcTypeString(value)
 	default:
 		return "", fmt.Errorf("not support type %T", typ)
 	}
 }
 
+// funcTypeString 函数类型, 不含参数名
+func (p *Parser) funcTypeString(typ *ast.FuncType) (string, error) {
+	fieldTypes := func(list *ast.FieldList) ([]string, error) {
+		var types []string
+		if list == nil {
+			return nil, nil
+		}
+		for _, field := range list.List {
+			ft, err := p.exprToString(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			for range max(len(field.Names), 1) {
+				types = append(types, ft)
+			}
+		}
+		return types, nil
+	}
+	params, err := fieldTypes(typ.Params)
+	if err != nil {
+		return "", err
+	}
+	results, err := fieldTypes(typ.Results)
+	if err != nil {
+		return "", err
+	}
+	switch len(results) {
+	case 0:
+		return fmt.Sprintf("func(%s)", strings.Join(params, ", ")), nil
+	case 1:
+		return fmt.Sprintf("func(%s) %s", strings.Join(params, ", "), results[0]), nil
+	}
+	return fmt.Sprintf("func(%s) (%s)", strings.Join(params, ", "), strings.Join(results, ", ")), nil
+}
+
 func (p *Parser) parseField(field *ast.Field) ([]*NameType, error) {
 	ft, err := p.exprToString(field.Type)
 	if err != nil {
@@ -195,6 +339,99 @@ func (p *Parser) parseField(field *ast.Field) ([]*NameType, error) {
 	return names, nil
 }
 
+// parseDirective 解析 "// @api key=value flag" 中的选项
+func parseDirective(text string) (map[string]string, error) {
+	_, args, _ := strings.Cut(text, "@api")
+	options := make(map[string]string)
+	for _, field := range strings.Fields(args) {
+		key, value, _ := strings.Cut(field, "=")
+		options[key] = value
+	}
+	if rate, ok := options["ratelimit"]; ok {
+		if _, err := ParseRate(rate); err != nil {
+			return nil, err
+		}
+	}
+	if burst, ok := options["burst"]; ok {
+		if _, err := strconv.Atoi(burst); err != nil {
+			return nil, fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	return options, nil
+}
+
+// importName 包的默认名字
+func importName(importPath string) string {
+	return path.Base(importPath)
+}
+
+// addCopyImports 记录复制到客户端的类型引用的包
+func (p *Parser) addCopyImports(file *ast.File, decl *ast.GenDecl) {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	ast.Inspect(decl, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				if importPath, ok := imports[ident.Name]; ok {
+					p.copyImports[ident.Name] = importPath
+				}
+			}
+		}
+		return true
+	})
+}
+
+// parseModel 解析 "@api crud" 标注的结构体
+func (p *Parser) parseModel(decl *ast.GenDecl, text string) error {
+	options, err := parseDirective(text)
+	if err != nil {
+		return err
+	}
+	if _, ok := options["crud"]; !ok {
+		return nil
+	}
+	for _, spec := range decl.Specs {
+		tspec, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		stype, ok := tspec.Type.(*ast.StructType)
+		if !ok {
+			return fmt.Errorf("%s: @api crud requires a struct type", tspec.Name.Name)
+		}
+		model := &Model{Name: tspec.Name.Name, Collection: options["collection"], IDType: "any", Options: options, Doc: decl.Doc}
+		if model.Collection == "" {
+			model.Collection = strings.ToLower(model.Name)
+		}
+		for _, field := range stype.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			if name, _, _ := strings.Cut(reflect.StructTag(tag).Get("bson"), ","); name == "_id" {
+				if model.IDType, err = p.exprToString(field.Type); err != nil {
+					return fmt.Errorf("%s: %w", model.Name, err)
+				}
+			}
+		}
+		p.Models = append(p.Models, model)
+	}
+	return nil
+}
+
 func (p *Parser) parseFuncDecl(fdecl *ast.FuncDecl) error {
 	for _, comment := range fdecl.Doc.List {
 		if strings.Contains(comment.Text, "@api") {
@@ -213,6 +450,9 @@ func (p *Parser) parseFuncDecl(fdecl *ast.FuncDecl) error {
 			}
 			method := &FuncDecl{Decl: fdecl, Name: fdecl.Name.Name, LastResultIndex: -1}
 			method.Recv = *names[0]
+			if method.Options, err = parseDirective(comment.Text); err != nil {
+				return fmt.Errorf("%s: %w", method.Name, err)
+			}
 			if fdecl.Type.Params != nil {
 				for _, param := range fdecl.Type.Params.List {
 					if names, err = p.parseField(param); err != nil {
@@ -234,7 +474,9 @@ func (p *Parser) parseFuncDecl(fdecl *ast.FuncDecl) error {
 					method.Results = append(method.Results, names...)
 				}
 			}
-			method.Init()
+			if err = method.Init(); err != nil {
+				return err
+			}
 			serviceName := strings.TrimPrefix(method.Recv.Type, "*")
 			if service, ok := p.Services[serviceName]; !ok {
 				//Name: method.Recv.Name
@@ -249,28 +491,145 @@ func (p *Parser) parseFuncDecl(fdecl *ast.FuncDecl) error {
 	return nil
 }
 
+// writeJSFetch 生成 JS 客户端的请求函数, 返回 envelope 中的 data
+func writeJSFetch(builder *strings.Builder, clientName string) {
+	builder.WriteString(fmt.Sprintf("%s.fetch = async function(path, method, request) {\n", clientName))
+	builder.WriteString("\tvar resp = await fetch(\"https://avpo.com\" + path, {\n")
+	builder.WriteString("\t\tmethod: method,\n")
+	builder.WriteString("\t\tbody: request ? JSON.stringify(request) : null,\n")
+	builder.WriteString("\t\theaders: {\n")
+	builder.WriteString("\t\t\t\"Content-Type\": \"application/json\"\n")
+	builder.WriteString("\t\t}\n")
+	builder.WriteString("\t})\n")
+	builder.WriteString("\tif (resp.status != 200) {\n")
+	builder.WriteString("\t\tthrow new Error(\"request failed\")\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\tvar msg = await resp.json()\n")
+	builder.WriteString("\tif (msg.code != 0) {\n")
+	builder.WriteString("\t\tthrow new Error(msg.error)\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\treturn msg.data\n")
+	builder.WriteString("}\n\n")
+}
+
+// writeJSStream 生成 JS 客户端的 SSE 流函数, 以 async iterator 返回每一项
+// EventSource 断线后自动携带 Last-Event-ID 重连
+func writeJSStream(builder *strings.Builder, clientName string) {
+	builder.WriteString(fmt.Sprintf("%s.stream = async function*(path, request) {\n", clientName))
+	builder.WriteString("\tvar url = \"https://avpo.com\" + path\n")
+	builder.WriteString("\tif (request) {\n")
+	builder.WriteString("\t\turl += \"?request=\" + encodeURIComponent(JSON.stringify(request))\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\tvar source = new EventSource(url)\n")
+	builder.WriteString("\tvar queue = []\n")
+	builder.WriteString("\tvar wake = null\n")
+	builder.WriteString("\tvar push = function(item) {\n")
+	builder.WriteString("\t\tqueue.push(item)\n")
+	builder.WriteString("\t\tif (wake) {\n")
+	builder.WriteString("\t\t\twake()\n")
+	builder.WriteString("\t\t\twake = null\n")
+	builder.WriteString("\t\t}\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\tsource.onmessage = function(e) {\n")
+	builder.WriteString("\t\tpush({data: JSON.parse(e.data)})\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\tsource.addEventListener(\"end\", function() {\n")
+	builder.WriteString("\t\tpush({done: true})\n")
+	builder.WriteString("\t})\n")
+	builder.WriteString("\tsource.addEventListener(\"error\", function(e) {\n")
+	builder.WriteString("\t\t// 带 data 的是服务端的错误事件, 否则为断线, EventSource 会自动重连\n")
+	builder.WriteString("\t\tif (e.data) {\n")
+	builder.WriteString("\t\t\tpush({error: new Error(JSON.parse(e.data).error)})\n")
+	builder.WriteString("\t\t}\n")
+	builder.WriteString("\t})\n")
+	builder.WriteString("\ttry {\n")
+	builder.WriteString("\t\twhile (true) {\n")
+	builder.WriteString("\t\t\tif (queue.length == 0) {\n")
+	builder.WriteString("\t\t\t\tawait new Promise(function(resolve) { wake = resolve })\n")
+	builder.WriteString("\t\t\t\tcontinue\n")
+	builder.WriteString("\t\t\t}\n")
+	builder.WriteString("\t\t\tvar item = queue.shift()\n")
+	builder.WriteString("\t\t\tif (item.done) {\n")
+	builder.WriteString("\t\t\t\treturn\n")
+	builder.WriteString("\t\t\t}\n")
+	builder.WriteString("\t\t\tif (item.error) {\n")
+	builder.WriteString("\t\t\t\tthrow item.error\n")
+	builder.WriteString("\t\t\t}\n")
+	builder.WriteString("\t\t\tyield item.data\n")
+	builder.WriteString("\t\t}\n")
+	builder.WriteString("\t} finally {\n")
+	builder.WriteString("\t\tsource.close()\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("}\n\n")
+}
+
+// hasStream 服务中是否有 SSE 流方法
+func (service *Service) hasStream() bool {
+	for _, method := range service.Methods {
+		if method.Stream != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSModel 生成 CRUD 模型的 JS 客户端
+func writeJSModel(builder *strings.Builder, hpath string, model *Model) {
+	clientName := model.Name + "CrudClient"
+	builder.WriteString(fmt.Sprintf("var %s = {}\n", clientName))
+	writeJSFetch(builder, clientName)
+	prefix := fmt.Sprintf("%s/%s", hpath, model.Name)
+	builder.WriteString("/** List Tabulator 分页查询, 返回 {last_page, data}\n * @param {object} params {page, size, sort, filter}\n */\n")
+	builder.WriteString(fmt.Sprintf("%s.List = async function(params) {\n", clientName))
+	builder.WriteString("\tvar resp = await fetch(\"https://avpo.com\" + \"" + prefix + "/List\", {\n")
+	builder.WriteString("\t\tmethod: \"POST\",\n")
+	builder.WriteString("\t\tbody: JSON.stringify(params || {}),\n")
+	builder.WriteString("\t\theaders: {\n")
+	builder.WriteString("\t\t\t\"Content-Type\": \"application/json\"\n")
+	builder.WriteString("\t\t}\n")
+	builder.WriteString("\t})\n")
+	builder.WriteString("\tif (resp.status != 200) {\n")
+	builder.WriteString("\t\tthrow new Error(\"request failed\")\n")
+	builder.WriteString("\t}\n")
+	builder.WriteString("\treturn await resp.json()\n")
+	builder.WriteString("}\n\n")
+	methods := []struct {
+		name, params, request, doc string
+	}{
+		{"Get", "id", "{id: id}", fmt.Sprintf(" * @param {%s} id\n * @returns {%s}\n", model.IDType, model.Name)},
+		{"Create", "data", "{data: data}", fmt.Sprintf(" * @param {%s} data\n * @returns {{id: %s}}\n", model.Name, model.IDType)},
+		{"Update", "id, data", "{id: id, data: data}", fmt.Sprintf(" * @param {%s} id\n * @param {%s} data\n", model.IDType, model.Name)},
+		{"Patch", "id, fields", "{id: id, fields: fields}", fmt.Sprintf(" * @param {%s} id\n * @param {object} fields\n", model.IDType)},
+		{"Delete", "id", "{id: id}", fmt.Sprintf(" * @param {%s} id\n", model.IDType)},
+	}
+	for _, method := range methods {
+		builder.WriteString(fmt.Sprintf("/** %s\n%s */\n", method.name, method.doc))
+		builder.WriteString(fmt.Sprintf("%s.%s = async function(%s) {\n", clientName, method.name, method.params))
+		builder.WriteString(fmt.Sprintf("\treturn await %s.fetch(\"%s/%s\", \"POST\", %s)\n", clientName, prefix, method.name, method.request))
+		builder.WriteString("}\n\n")
+	}
+}
+
 func (p *Parser) WriteJS(hpath, path string) error {
 	builder := &strings.Builder{}
+	// gen.Resolve 后参数和返回值使用 JS 类型, 引用的结构体生成 typedef
+	var js JSDocTypes
+	if p.JSDoc != nil {
+		js = p.JSDoc()
+	}
+	jsType := func(typ string, info *TypeInfo) string {
+		if js == nil || info == nil {
+			return typ
+		}
+		return js.Type(info)
+	}
 	for name, service := range p.Services {
 		clientName := name + "Client"
 		builder.WriteString(fmt.Sprintf("var %s = {}\n", clientName))
-		builder.WriteString(fmt.Sprintf("%s.fetch = async function(path, method, request) {\n", clientName))
-		builder.WriteString("\tvar resp = await fetch(\"https://avpo.com\" + path, {\n")
-		builder.WriteString("\t\tmethod: method,\n")
-		builder.WriteString("\t\tbody: request ? JSON.stringify(request) : null,\n")
-		builder.WriteString("\t\theaders: {\n")
-		builder.WriteString("\t\t\t\"Content-Type\": \"application/json\"\n")
-		builder.WriteString("\t\t}\n")
-		builder.WriteString("\t})\n")
-		builder.WriteString("\tif (resp.status != 200) {\n")
-		builder.WriteString("\t\tthrow new Error(\"request failed\")\n")
-		builder.WriteString("\t}\n")
-		builder.WriteString("\tvar msg = await resp.json()\n")
-		builder.WriteString("\tif (msg.code != 0) {\n")
-		builder.WriteString("\t\tthrow new Error(msg.error)\n")
-		builder.WriteString("\t}\n")
-		builder.WriteString("\treturn msg.data\n")
-		builder.WriteString("}\n\n")
+		writeJSFetch(builder, clientName)
+		if service.hasStream() {
+			writeJSStream(builder, clientName)
+		}
 
 		for _, method := range service.Methods {
 			var paramStrings []string
@@ -284,12 +643,31 @@ func (p *Parser) WriteJS(hpath, path string) error {
 				}
 			}
 			for _, param := range method.Params {
-				builder.WriteString(fmt.Sprintf(" * @param {%s} %s\n", param.Type, param.Name))
+				builder.WriteString(fmt.Sprintf(" * @param {%s} %s\n", jsType(param.Type, param.Info), param.Name))
 			}
-			for _, ret := range method.Results {
-				builder.WriteString(fmt.Sprintf(" * @returns {%s}\n", ret.Type))
+			if method.Stream != "" {
+				builder.WriteString(fmt.Sprintf(" * @returns {AsyncGenerator<%s>}\n", jsType(method.Stream, method.StreamInfo)))
+			} else {
+				for _, ret := range method.Results {
+					builder.WriteString(fmt.Sprintf(" * @returns {%s}\n", jsType(ret.Type, ret.Info)))
+				}
 			}
 			builder.WriteString(" */\n")
+			if method.Stream != "" {
+				builder.WriteString(fmt.Sprintf("%s.%s = function(%s) {\n", clientName, method.Name, strings.Join(paramStrings, ", ")))
+				if len(method.Params) > 0 {
+					builder.WriteString("var req = {\n")
+					for _, param := range method.Params {
+						builder.WriteString(fmt.Sprintf("\t%s: %s,\n", GoCamelCase(param.Name), param.Name))
+					}
+					builder.WriteString("}\n")
+					builder.WriteString(fmt.Sprintf("\treturn %s.stream(\"%s/%s/%s\", req)\n", clientName, hpath, name, method.Name))
+				} else {
+					builder.WriteString(fmt.Sprintf("\treturn %s.stream(\"%s/%s/%s\", null)\n", clientName, hpath, name, method.Name))
+				}
+				builder.WriteString("}\n\n")
+				continue
+			}
 			if len(paramStrings) == 0 {
 				builder.WriteString(fmt.Sprintf("%s.%s = async function() {\n", clientName, method.Name))
 			} else {
@@ -310,6 +688,13 @@ func (p *Parser) WriteJS(hpath, path string) error {
 			builder.WriteString("}\n\n")
 		}
 	}
+	for _, model := range p.Models {
+		jsType(model.Name, model.Info)
+		writeJSModel(builder, hpath, model)
+	}
+	if js != nil {
+		builder.WriteString(js.Typedefs())
+	}
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
@@ -319,31 +704,97 @@ func (p *Parser) WriteJS(hpath, path string) error {
 	return nil
 }
 
+// zeroValue 生成代码中类型的零值
+func zeroValue(typ string) string {
+	switch {
+	case strings.HasPrefix(typ, "*"), strings.HasPrefix(typ, "[]"), strings.HasPrefix(typ, "map["), typ == "any", typ == "error":
+		return "nil"
+	case typ == "string":
+		return "\"\""
+	case typ == "bool":
+		return "false"
+	}
+	return fmt.Sprintf("*new(%s)", typ)
+}
+
+// writeClientModel 生成 CRUD 模型的 Go 客户端
+func writeClientModel(builder *strings.Builder, hpath string, model *Model) {
+	clientName := model.Name + "CrudClient"
+	prefix := fmt.Sprintf("%s/%s", hpath, model.Name)
+	builder.WriteString(fmt.Sprintf("type %s struct {\n\tclient *apigo.Client\n\tctx    context.Context\n}\n", clientName))
+	builder.WriteString(fmt.Sprintf("\nfunc New%s(client *apigo.Client) *%s {\n", clientName, clientName))
+	builder.WriteString(fmt.Sprintf("\treturn &%s{client: client, ctx: context.Background()}\n}\n", clientName))
+	builder.WriteString("\n// WithContext 返回使用 ctx 发送请求的客户端, ctx 中的 span 作为请求 span 的父 span\n")
+	builder.WriteString(fmt.Sprintf("func (c *%s) WithContext(ctx context.Context) *%s {\n", clientName, clientName))
+	builder.WriteString(fmt.Sprintf("\treturn &%s{client: c.client, ctx: ctx}\n}\n\n", clientName))
+	builder.WriteString("// List Tabulator 分页查询\n")
+	builder.WriteString(fmt.Sprintf("func (c *%s) List(request *apigo.TabulatorRequest) (*apigo.TabulatorResult[%s], error) {\n", clientName, model.Name))
+	builder.WriteString(fmt.Sprintf("\treturn apigo.ListTabulatorContext[%s](c.ctx, c.client, \"%s/List\", request)\n}\n\n", model.Name, prefix))
+	builder.WriteString(fmt.Sprintf("func (c *%s) Get(id %s) (*%s, error) {\n", clientName, model.IDType, model.Name))
+	builder.WriteString(fmt.Sprintf("\treturn apigo.RequestContext[%s](c.ctx, c.client, \"%s/Get\", http.MethodPost, &apigo.CRUDRequest[%s]{ID: id})\n}\n\n", model.Name, prefix, model.Name))
+	builder.WriteString("// Create 返回新记录的 ID\n")
+	builder.WriteString(fmt.Sprintf("func (c *%s) Create(data *%s) (%s, error) {\n", clientName, model.Name, model.IDType))
+	builder.WriteString(fmt.Sprintf("\tresp, err := apigo.RequestContext[apigo.CRUDCreated[%s]](c.ctx, c.client, \"%s/Create\", http.MethodPost, &apigo.CRUDRequest[%s]{Data: data})\n", model.IDType, prefix, model.Name))
+	builder.WriteString(fmt.Sprintf("\tif err != nil {\n\t\treturn %s, err\n\t}\n", zeroValue(model.IDType)))
+	builder.WriteString("\treturn resp.ID, nil\n}\n\n")
+	builder.WriteString(fmt.Sprintf("func (c *%s) Update(id %s, data *%s) error {\n", clientName, model.IDType, model.Name))
+	builder.WriteString(fmt.Sprintf("\treturn apigo.NotifyContext(c.ctx, c.client, \"%s/Update\", http.MethodPost, &apigo.CRUDRequest[%s]{ID: id, Data: data})\n}\n\n", prefix, model.Name))
+	builder.WriteString("// Patch 只修改 fields 中的字段\n")
+	builder.WriteString(fmt.Sprintf("func (c *%s) Patch(id %s, fields map[string]any) error {\n", clientName, model.IDType))
+	builder.WriteString(fmt.Sprintf("\treturn apigo.NotifyContext(c.ctx, c.client, \"%s/Patch\", http.MethodPost, &apigo.CRUDRequest[%s]{ID: id, Fields: fields})\n}\n\n", prefix, model.Name))
+	builder.WriteString(fmt.Sprintf("func (c *%s) Delete(id %s) error {\n", clientName, model.IDType))
+	builder.WriteString(fmt.Sprintf("\treturn apigo.NotifyContext(c.ctx, c.client, \"%s/Delete\", http.MethodPost, &apigo.CRUDRequest[%s]{ID: id})\n}\n\n", prefix, model.Name))
+}
+
 func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 	builder := &strings.Builder{}
-	// buf := new(bytes.Buffer)
-	// ffile := &ast.File{
-	// 	Name:  ast.NewIdent(pkgname),
-	// 	Decls: []ast.Decl{&ast.GenDecl{Tok: token.TYPE, Specs: p.copySpecs}},
-	// }
-	// if err := format.Node(buf, p.fileset, ffile); err != nil {
-	// 	return err
-	// }
-	// log.Println(buf.String())
 	builder.WriteString("package " + pkgname + "\n\n")
 	builder.WriteString("import (\n")
+	needHTTP := len(p.Models) > 0
+	for _, service := range p.Services {
+		for _, method := range service.Methods {
+			needHTTP = needHTTP || method.Stream == ""
+		}
+	}
+	if len(p.Services) > 0 || len(p.Models) > 0 {
+		builder.WriteString("\t\"context\"\n")
+	}
+	if needHTTP {
+		builder.WriteString("\t\"net/http\"\n")
+	}
+	builder.WriteString("\n")
 	builder.WriteString("\t\"github.com/zdypro888/apigo\"\n")
+	for name, importPath := range p.copyImports {
+		if importName(importPath) == name {
+			builder.WriteString(fmt.Sprintf("\t%q\n", importPath))
+		} else {
+			builder.WriteString(fmt.Sprintf("\t%s %q\n", name, importPath))
+		}
+	}
 	builder.WriteString(")\n\n")
+	if len(p.copySpecs) > 0 {
+		// 复制 @api 标注的类型
+		buf := new(bytes.Buffer)
+		if err := format.Node(buf, p.fileset, &ast.GenDecl{Tok: token.TYPE, Lparen: 1, Specs: p.copySpecs}); err != nil {
+			return err
+		}
+		builder.Write(buf.Bytes())
+		builder.WriteString("\n\n")
+	}
 
 	for name, service := range p.Services {
 		clientName := name + "Client"
 		// Generate struct type with service name and client instance
 		builder.WriteString(fmt.Sprintf("type %s struct {\n", clientName))
 		builder.WriteString("\tclient *apigo.Client\n")
+		builder.WriteString("\tctx    context.Context\n")
 		builder.WriteString("}\n")
 		// Generate "New<service name>Client" function to get client instance
 		builder.WriteString(fmt.Sprintf("\nfunc New%s(client *apigo.Client) *%s {\n", clientName, clientName))
-		builder.WriteString(fmt.Sprintf("\treturn &%s{client: client}\n}\n", clientName))
+		builder.WriteString(fmt.Sprintf("\treturn &%s{client: client, ctx: context.Background()}\n}\n", clientName))
+		builder.WriteString("\n// WithContext 返回使用 ctx 发送请求的客户端, ctx 中的 span 作为请求 span 的父 span\n")
+		builder.WriteString(fmt.Sprintf("func (c *%s) WithContext(ctx context.Context) *%s {\n", clientName, clientName))
+		builder.WriteString(fmt.Sprintf("\treturn &%s{client: c.client, ctx: ctx}\n}\n", clientName))
 
 		// Loop through methods to generate method code
 		for _, method := range service.Methods {
@@ -358,18 +809,41 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 			if len(retStrings) == 0 || retStrings[len(retStrings)-1] != "error" {
 				retStrings = append(retStrings, "error")
 			}
+			call := name + "." + method.Name
+			requestName, responseName := name+method.Name+"Request", name+method.Name+"Response"
+			if method.Stream == "" {
+				// 导出的请求和响应类型, 同时用于 BatchCall
+				method.writeRR(builder, requestName, responseName, call)
+				builder.WriteString("\n")
+			}
 			// Generate function doc
 			for _, comment := range method.Decl.Doc.List {
 				if !strings.Contains(comment.Text, "@api") {
 					builder.WriteString(fmt.Sprintf("%s\n", comment.Text))
 				}
 			}
+			if method.Stream != "" {
+				// SSE 流, 返回迭代器
+				builder.WriteString(fmt.Sprintf("func (c *%s) %s(%s) (*apigo.Stream[%s], error) {\n", clientName, method.Name, strings.Join(paramStrings, ", "), method.Stream))
+				method.WriteRR(builder)
+				if len(method.Params) > 0 {
+					builder.WriteString("req := &Request{\n")
+					for _, param := range method.Params {
+						builder.WriteString(fmt.Sprintf("\t%s: %s,\n", GoCamelCase(param.Name), param.Name))
+					}
+					builder.WriteString("}\n")
+					builder.WriteString(fmt.Sprintf("\treturn apigo.OpenStreamContext[%s](c.ctx, c.client, \"%s/%s/%s\", req)\n", method.Stream, hpath, name, method.Name))
+				} else {
+					builder.WriteString(fmt.Sprintf("\treturn apigo.OpenStreamContext[%s](c.ctx, c.client, \"%s/%s/%s\", nil)\n", method.Stream, hpath, name, method.Name))
+				}
+				builder.WriteString("}\n\n")
+				continue
+			}
 			// Generate function signature
 			builder.WriteString(fmt.Sprintf("func (c *%s) %s(%s) (%s) {\n", clientName, method.Name, strings.Join(paramStrings, ", "), strings.Join(retStrings, ", ")))
-			method.WriteRR(builder)
 			if len(method.Params) > 0 {
 				// Generate request object
-				builder.WriteString("req := &Request{\n")
+				builder.WriteString(fmt.Sprintf("req := &%s{\n", requestName))
 				for _, param := range method.Params {
 					builder.WriteString(fmt.Sprintf("\t%s: %s,\n", GoCamelCase(param.Name), param.Name))
 				}
@@ -381,7 +855,7 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 					if i == method.LastResultIndex && ret.Type == "error" {
 						nilStrings = append(nilStrings, "err")
 					} else {
-						nilStrings = append(nilStrings, "nil")
+						nilStrings = append(nilStrings, zeroValue(ret.Type))
 					}
 				}
 				writer.WriteString("\treturn ")
@@ -404,11 +878,11 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 			// Generate request code
 			if len(method.Params) == 0 {
 				if !method.HasNormalResult {
-					builder.WriteString(fmt.Sprintf("\tif err := apigo.Notify(c.client, \"%s/%s/%s\", http.MethodGet, nil); err != nil {\n", hpath, name, method.Name))
+					builder.WriteString(fmt.Sprintf("\tif err := apigo.NotifyContext(c.ctx, c.client, \"%s/%s/%s\", http.MethodGet, nil); err != nil {\n", hpath, name, method.Name))
 					builder.WriteString("\t\treturn err\n\t}\n")
 					builder.WriteString("\treturn nil\n")
 				} else {
-					builder.WriteString(fmt.Sprintf("\tresp, err := apigo.Request[Response](c.client, \"%s/%s/%s\", http.MethodGet, nil)\n", hpath, name, method.Name))
+					builder.WriteString(fmt.Sprintf("\tresp, err := apigo.RequestContext[%s](c.ctx, c.client, \"%s/%s/%s\", http.MethodGet, nil)\n", responseName, hpath, name, method.Name))
 					builder.WriteString("\tif err != nil {\n")
 					writeErrResult(builder)
 					builder.WriteString("\t}\n")
@@ -416,11 +890,11 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 				}
 			} else {
 				if !method.HasNormalResult {
-					builder.WriteString(fmt.Sprintf("\tif err := apigo.Notify(c.client, \"%s/%s/%s\", http.MethodPost, req); err != nil {\n", hpath, name, method.Name))
+					builder.WriteString(fmt.Sprintf("\tif err := apigo.NotifyContext(c.ctx, c.client, \"%s/%s/%s\", http.MethodPost, req); err != nil {\n", hpath, name, method.Name))
 					builder.WriteString("\t\treturn err\n\t}\n")
 					builder.WriteString("\treturn nil\n")
 				} else {
-					builder.WriteString(fmt.Sprintf("\tresp, err := apigo.Request[Response](c.client, \"%s/%s/%s\", http.MethodPost, &req)\n", hpath, name, method.Name))
+					builder.WriteString(fmt.Sprintf("\tresp, err := apigo.RequestContext[%s](c.ctx, c.client, \"%s/%s/%s\", http.MethodPost, req)\n", responseName, hpath, name, method.Name))
 					builder.WriteString("\tif err != nil {\n")
 					writeErrResult(builder)
 					builder.WriteString("\t}\n")
@@ -428,8 +902,32 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 				}
 			}
 			builder.WriteString("}\n\n")
+			// 批量调用
+			batchResult := "struct{}"
+			if method.HasNormalResult {
+				batchResult = responseName
+			}
+			builder.WriteString(fmt.Sprintf("// %sBatch 向 batch 添加一次 %s 调用, batch.Do 之后通过 Result 读取结果\n", method.Name, call))
+			builder.WriteString(fmt.Sprintf("func (c *%s) %sBatch(batch *apigo.Batch", clientName, method.Name))
+			for _, param := range paramStrings {
+				builder.WriteString(", " + param)
+			}
+			builder.WriteString(fmt.Sprintf(") *apigo.BatchResult[%s] {\n", batchResult))
+			if len(method.Params) > 0 {
+				builder.WriteString(fmt.Sprintf("\treturn apigo.BatchCall[%s](batch, %q, &%s{\n", batchResult, call, requestName))
+				for _, param := range method.Params {
+					builder.WriteString(fmt.Sprintf("\t%s: %s,\n", GoCamelCase(param.Name), param.Name))
+				}
+				builder.WriteString("})\n")
+			} else {
+				builder.WriteString(fmt.Sprintf("\treturn apigo.BatchCall[%s](batch, %q, nil)\n", batchResult, call))
+			}
+			builder.WriteString("}\n\n")
 		}
 	}
+	for _, model := range p.Models {
+		writeClientModel(builder, hpath, model)
+	}
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
@@ -443,13 +941,58 @@ func (p *Parser) WriteClient(pkgname, hpath, path string) error {
 	return nil
 }
 
+// writeServerStream 生成 SSE 流方法的处理函数体
+func (p *Parser) writeServerStream(builder *strings.Builder, service *Service, method *FuncDecl) {
+	var paramStrings []string
+	if len(method.Params) > 0 {
+		builder.WriteString("req, err := apigo.ReadStreamRequest[Request](s.server, ctx)\n")
+		builder.WriteString("if err != nil {\n")
+		builder.WriteString("\ts.server.ResponseError(ctx, 500, err)\n")
+		builder.WriteString("\treturn\n")
+		builder.WriteString("}\n")
+		for _, param := range method.Params {
+			paramStrings = append(paramStrings, fmt.Sprintf("req.%s", GoCamelCase(param.Name)))
+		}
+	}
+	if method.Emitter >= 0 {
+		paramStrings = append(paramStrings[:method.Emitter:method.Emitter], append([]string{"emit"}, paramStrings[method.Emitter:]...)...)
+		call := fmt.Sprintf("s.%s.%s(%s)", service.Name, method.Name, strings.Join(paramStrings, ", "))
+		builder.WriteString(fmt.Sprintf("apigo.StreamEmitter(s.server, ctx, func(emit func(%s) error) error {\n", method.Stream))
+		if method.LastResultError {
+			builder.WriteString(fmt.Sprintf("\treturn %s\n", call))
+		} else {
+			builder.WriteString(fmt.Sprintf("\t%s\n\treturn nil\n", call))
+		}
+		builder.WriteString("})\n")
+		builder.WriteString("}\n\n")
+		return
+	}
+	call := fmt.Sprintf("s.%s.%s(%s)", service.Name, method.Name, strings.Join(paramStrings, ", "))
+	if method.LastResultError {
+		builder.WriteString(fmt.Sprintf("items, err := %s\n", call))
+		builder.WriteString("if err != nil {\n")
+		builder.WriteString("\ts.server.ResponseError(ctx, 501, err)\n")
+		builder.WriteString("\treturn\n")
+		builder.WriteString("}\n")
+	} else {
+		builder.WriteString(fmt.Sprintf("items := %s\n", call))
+	}
+	builder.WriteString("apigo.StreamEvents(s.server, ctx, items)\n")
+	builder.WriteString("}\n\n")
+}
+
 func (p *Parser) WriteServer(pkgname, hpath, path string) error {
 	builder := &strings.Builder{}
 	builder.WriteString("package " + pkgname)
 	builder.WriteString("\n\nimport (\n")
-	builder.WriteString("\t\"net/http\"\n")
-	builder.WriteString("\t\"github.com/kataras/iris/v12\"\n")
+	if len(p.Services) > 0 {
+		builder.WriteString("\t\"net/http\"\n")
+		builder.WriteString("\t\"github.com/gin-gonic/gin\"\n")
+	}
 	builder.WriteString("\t\"github.com/zdypro888/apigo\"\n")
+	if len(p.Models) > 0 {
+		builder.WriteString("\t\"go.mongodb.org/mongo-driver/mongo\"\n")
+	}
 	builder.WriteString(")\n\n")
 
 	for name, service := range p.Services {
@@ -470,16 +1013,38 @@ func (p *Parser) WriteServer(pkgname, hpath, path string) error {
 
 		builder.WriteString(fmt.Sprintf("func (s *%s) init() {\n", serviceName))
 		for _, method := range service.Methods {
+			var options string
+			if rate, ok := method.Options["ratelimit"]; ok {
+				burst := method.Options["burst"]
+				if burst == "" {
+					burst = "0"
+				}
+				options = fmt.Sprintf(", apigo.WithRateLimit(%q, %s)", rate, burst)
+			}
 			if len(method.Params) > 0 {
-				builder.WriteString(fmt.Sprintf("\ts.server.HandlePost(\"%s/%s/%s\", s.handle%s)\n", hpath, name, method.Name, method.Name))
+				var names []string
+				for _, param := range method.Params {
+					names = append(names, strconv.Quote(param.Name))
+				}
+				options += fmt.Sprintf(", apigo.WithParams(%s)", strings.Join(names, ", "))
+			}
+			if method.Stream != "" {
+				options += ", apigo.WithStream()"
+			}
+			if len(method.Params) > 0 && method.Stream == "" {
+				builder.WriteString(fmt.Sprintf("\ts.server.HandleAPI(http.MethodPost, \"%s\", \"%s\", \"%s/%s/%s\", s.handle%s%s)\n", name, method.Name, hpath, name, method.Name, method.Name, options))
 			} else {
-				builder.WriteString(fmt.Sprintf("\ts.server.HandleGet(\"%s/%s/%s\", s.handle%s)\n", hpath, name, method.Name, method.Name))
+				builder.WriteString(fmt.Sprintf("\ts.server.HandleAPI(http.MethodGet, \"%s\", \"%s\", \"%s/%s/%s\", s.handle%s%s)\n", name, method.Name, hpath, name, method.Name, method.Name, options))
 			}
 		}
 		builder.WriteString("}\n\n")
 		for _, method := range service.Methods {
 			builder.WriteString(fmt.Sprintf("func (s *%s) handle%s(ctx *gin.Context) {\n", serviceName, method.Name))
 			method.WriteRR(builder)
+			if method.Stream != "" {
+				p.writeServerStream(builder, service, method)
+				continue
+			}
 			if len(method.Params) > 0 {
 				// Generate request object
 				builder.WriteString("req, err := apigo.ReadMessage[Request](s.server, ctx)\n")
@@ -534,6 +1099,22 @@ func (p *Parser) WriteServer(pkgname, hpath, path string) error {
 			builder.WriteString("}\n\n")
 		}
 	}
+	for _, model := range p.Models {
+		modelType := model.Name
+		if p.Pkgname != pkgname {
+			modelType = p.Pkgname + "." + model.Name
+		}
+		apiName := model.Name + "CrudApi"
+		builder.WriteString(fmt.Sprintf("type %s struct {\n", apiName))
+		builder.WriteString("\tserver *apigo.Server\n")
+		builder.WriteString(fmt.Sprintf("\tStore apigo.CRUDStore[%s]\n", modelType))
+		builder.WriteString("}\n")
+		builder.WriteString(fmt.Sprintf("\n// New%s 注册 %s 的 CRUD 接口, 读写和 List 都使用 database 中的集合 %s\n", apiName, model.Name, model.Collection))
+		builder.WriteString(fmt.Sprintf("func New%s(server *apigo.Server, database *mongo.Database, options ...apigo.QueryOption) *%s {\n", apiName, apiName))
+		builder.WriteString(fmt.Sprintf("\ts := &%s{server: server, Store: apigo.NewMongoStore[%s](database.Collection(%q))}\n", apiName, modelType, model.Collection))
+		builder.WriteString(fmt.Sprintf("\tapigo.HandleCRUD[%s](server, \"%s\", \"%s/%s\", s.Store, options...)\n", modelType, model.Name, hpath, model.Name))
+		builder.WriteString("\treturn s\n}\n\n")
+	}
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
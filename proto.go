@@ -0,0 +1,799 @@
+package apigo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+)
+
+// protoScalars Go 基础类型对应的 proto 类型
+var protoScalars = map[string]string{
+	"int":     "int64",
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"rune":    "int32",
+	"int64":   "int64",
+	"uint":    "uint64",
+	"uint8":   "uint32",
+	"byte":    "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"float32": "float",
+	"float64": "double",
+	"string":  "string",
+	"bool":    "bool",
+}
+
+// protoGoTypes proto 类型在 protoc-gen-go 生成代码中的 Go 类型
+var protoGoTypes = map[string]string{
+	"int32":  "int32",
+	"int64":  "int64",
+	"uint32": "uint32",
+	"uint64": "uint64",
+	"float":  "float32",
+	"double": "float64",
+	"string": "string",
+	"bool":   "bool",
+	"bytes":  "[]byte",
+}
+
+// protoField message 中的字段
+type protoField struct {
+	Name   string
+	Type   string
+	Number int
+}
+
+// protoMessage 生成的 message
+type protoMessage struct {
+	Name   string
+	Fields []*protoField
+	// Reserved 已删除字段的编号和名称
+	Reserved *protoReserved
+}
+
+// protoGen 从 @api 服务生成 proto 文件和 gRPC 适配代码
+// message 的字段与 Go 类型的转换代码同时生成
+type protoGen struct {
+	p *Parser
+	// qualify 生成代码不在 p.Pkgname 包中时, 包内类型加包名
+	qualify  bool
+	messages []*protoMessage
+	names    map[string]bool
+	// converts 结构体与 pb message 的转换函数
+	converts []string
+	imports  map[string]bool
+}
+
+func (p *Parser) newProtoGen(pkgname string) *protoGen {
+	return &protoGen{p: p, qualify: pkgname != p.Pkgname, names: make(map[string]bool), imports: make(map[string]bool)}
+}
+
+// grpcServices 按名称排序的服务, 跳过 @api grpc=false 的方法
+func (p *Parser) grpcServices() ([]string, map[string][]*FuncDecl) {
+	var names []string
+	methods := make(map[string][]*FuncDecl)
+	for name, service := range p.Services {
+		for _, method := range service.Methods {
+			if method.Options["grpc"] != "false" {
+				methods[name] = append(methods[name], method)
+			}
+		}
+		if len(methods[name]) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, methods
+}
+
+// protoFieldName Go 名称对应的 proto 字段名, protoc-gen-go 生成的字段名为 GoCamelCase(字段名)
+// 数字前不加下划线: Result0 -> result0
+func protoFieldName(name string) string {
+	snake := strcase.ToSnake(name)
+	builder := &strings.Builder{}
+	for i := 0; i < len(snake); i++ {
+		if snake[i] == '_' && i+1 < len(snake) && snake[i+1] >= '0' && snake[i+1] <= '9' {
+			continue
+		}
+		builder.WriteByte(snake[i])
+	}
+	return builder.String()
+}
+
+// resolve 包内命名类型的声明, 其他类型返回 nil
+func (g *protoGen) resolve(expr ast.Expr) *ast.TypeSpec {
+	if ident, ok := expr.(*ast.Ident); ok {
+		if _, scalar := protoScalars[ident.Name]; !scalar {
+			return g.p.types[ident.Name]
+		}
+	}
+	return nil
+}
+
+// structName 包内结构体类型的名称
+func (g *protoGen) structName(expr ast.Expr) (string, bool) {
+	if spec := g.resolve(expr); spec != nil {
+		if _, ok := spec.Type.(*ast.StructType); ok && spec.TypeParams == nil {
+			return spec.Name.Name, true
+		}
+	}
+	return "", false
+}
+
+// scalar 基础类型(包括以基础类型定义的命名类型)对应的 proto 类型
+func (g *protoGen) scalar(expr ast.Expr) (string, bool) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return "", false
+	}
+	if proto, ok := protoScalars[ident.Name]; ok {
+		return proto, true
+	}
+	if spec := g.resolve(expr); spec != nil {
+		return g.scalar(spec.Type)
+	}
+	return "", false
+}
+
+// selector time.Time 和 primitive.ObjectID 对应的 proto 类型
+func selectorType(expr ast.Expr) string {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			return pkg.Name + "." + sel.Sel.Name
+		}
+	}
+	return ""
+}
+
+// goType 生成代码中的 Go 类型
+func (g *protoGen) goType(expr ast.Expr) string {
+	switch value := expr.(type) {
+	case *ast.Ident:
+		if g.qualify && g.p.types[value.Name] != nil {
+			return g.p.Pkgname + "." + value.Name
+		}
+		return value.Name
+	case *ast.StarExpr:
+		return "*" + g.goType(value.X)
+	case *ast.ArrayType:
+		return "[]" + g.goType(value.Elt)
+	case *ast.MapType:
+		return fmt.Sprintf("map[%s]%s", g.goType(value.Key), g.goType(value.Value))
+	case *ast.SelectorExpr:
+		return selectorType(value)
+	}
+	return ""
+}
+
+// isBytes []byte
+func (g *protoGen) isBytes(expr ast.Expr) bool {
+	if spec := g.resolve(expr); spec != nil {
+		return g.isBytes(spec.Type)
+	}
+	if array, ok := expr.(*ast.ArrayType); ok && array.Len == nil {
+		if ident, ok := array.Elt.(*ast.Ident); ok {
+			return ident.Name == "byte" || ident.Name == "uint8"
+		}
+	}
+	return false
+}
+
+// fieldType 字段的 proto 类型, 结构体同时生成 message
+func (g *protoGen) fieldType(expr ast.Expr) (string, error) {
+	if proto, ok := g.scalar(expr); ok {
+		return proto, nil
+	}
+	if g.isBytes(expr) {
+		return "bytes", nil
+	}
+	switch selectorType(expr) {
+	case "time.Time":
+		// unix 毫秒
+		return "int64", nil
+	case "primitive.ObjectID":
+		return "string", nil
+	}
+	if name, ok := g.structName(expr); ok {
+		return name, g.message(name)
+	}
+	if spec := g.resolve(expr); spec != nil {
+		return g.fieldType(spec.Type)
+	}
+	switch value := expr.(type) {
+	case *ast.StarExpr:
+		if name, ok := g.structName(value.X); ok {
+			return name, g.message(name)
+		}
+	case *ast.ArrayType:
+		if value.Len != nil {
+			break
+		}
+		elem, err := g.fieldType(value.Elt)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(elem, "repeated ") || strings.HasPrefix(elem, "map<") {
+			return "", fmt.Errorf("proto: nested repeated type %s not supported", g.goType(expr))
+		}
+		return "repeated " + elem, nil
+	case *ast.MapType:
+		key, ok := g.scalar(value.Key)
+		if !ok || key == "float" || key == "double" {
+			return "", fmt.Errorf("proto: map key type %s not supported", g.goType(value.Key))
+		}
+		elem, err := g.fieldType(value.Value)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(elem, "repeated ") || strings.HasPrefix(elem, "map<") {
+			return "", fmt.Errorf("proto: map value type %s not supported", g.goType(value.Value))
+		}
+		return fmt.Sprintf("map<%s, %s>", key, elem), nil
+	}
+	return "", fmt.Errorf("proto: type %s not supported", g.goType(expr))
+}
+
+// pbType 字段在 pb 包中的 Go 类型
+func (g *protoGen) pbType(expr ast.Expr) string {
+	if proto, ok := g.scalar(expr); ok {
+		return protoGoTypes[proto]
+	}
+	if g.isBytes(expr) {
+		return "[]byte"
+	}
+	switch selectorType(expr) {
+	case "time.Time":
+		return "int64"
+	case "primitive.ObjectID":
+		return "string"
+	}
+	if name, ok := g.structName(expr); ok {
+		return "*pb." + name
+	}
+	if spec := g.resolve(expr); spec != nil {
+		return g.pbType(spec.Type)
+	}
+	switch value := expr.(type) {
+	case *ast.StarExpr:
+		return g.pbType(value.X)
+	case *ast.ArrayType:
+		return "[]" + g.pbType(value.Elt)
+	case *ast.MapType:
+		return fmt.Sprintf("map[%s]%s", g.pbType(value.Key), g.pbType(value.Value))
+	}
+	return ""
+}
+
+// toPb 将 Go 值 v 转换为 pb 值的表达式, 结构体值的 v 必须可取地址
+func (g *protoGen) toPb(expr ast.Expr, v string) string {
+	if g.goType(expr) == g.pbType(expr) {
+		return v
+	}
+	if proto, ok := g.scalar(expr); ok {
+		return fmt.Sprintf("%s(%s)", protoGoTypes[proto], v)
+	}
+	if g.isBytes(expr) {
+		return fmt.Sprintf("[]byte(%s)", v)
+	}
+	switch selectorType(expr) {
+	case "time.Time":
+		return v + ".UnixMilli()"
+	case "primitive.ObjectID":
+		return v + ".Hex()"
+	}
+	if name, ok := g.structName(expr); ok {
+		return fmt.Sprintf("toPb%s(&%s)", name, v)
+	}
+	if spec := g.resolve(expr); spec != nil {
+		return g.toPb(spec.Type, v)
+	}
+	switch value := expr.(type) {
+	case *ast.StarExpr:
+		name, _ := g.structName(value.X)
+		return fmt.Sprintf("toPb%s(%s)", name, v)
+	case *ast.ArrayType:
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.ConvertSlice(%s, func(e %s) %s { return %s })", v, g.goType(value.Elt), g.pbType(value.Elt), g.toPb(value.Elt, "e"))
+	case *ast.MapType:
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.ConvertMap(%s, func(k %s) %s { return %s }, func(e %s) %s { return %s })", v,
+			g.goType(value.Key), g.pbType(value.Key), g.toPb(value.Key, "k"),
+			g.goType(value.Value), g.pbType(value.Value), g.toPb(value.Value, "e"))
+	}
+	return v
+}
+
+// fromPb 将 pb 值 v 转换为 Go 值的表达式
+func (g *protoGen) fromPb(expr ast.Expr, v string) string {
+	if g.goType(expr) == g.pbType(expr) {
+		return v
+	}
+	if _, ok := g.scalar(expr); ok || g.isBytes(expr) {
+		return fmt.Sprintf("%s(%s)", g.goType(expr), v)
+	}
+	switch selectorType(expr) {
+	case "time.Time":
+		g.imports["time"] = true
+		return fmt.Sprintf("time.UnixMilli(%s)", v)
+	case "primitive.ObjectID":
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.ObjectIDFromHex(%s)", v)
+	}
+	if name, ok := g.structName(expr); ok {
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.Deref(fromPb%s(%s))", name, v)
+	}
+	if spec := g.resolve(expr); spec != nil {
+		return fmt.Sprintf("%s(%s)", g.goType(expr), g.fromPb(spec.Type, v))
+	}
+	switch value := expr.(type) {
+	case *ast.StarExpr:
+		name, _ := g.structName(value.X)
+		return fmt.Sprintf("fromPb%s(%s)", name, v)
+	case *ast.ArrayType:
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.ConvertSlice(%s, func(e %s) %s { return %s })", v, g.pbType(value.Elt), g.goType(value.Elt), g.fromPb(value.Elt, "e"))
+	case *ast.MapType:
+		g.imports["github.com/zdypro888/apigo"] = true
+		return fmt.Sprintf("apigo.ConvertMap(%s, func(k %s) %s { return %s }, func(e %s) %s { return %s })", v,
+			g.pbType(value.Key), g.goType(value.Key), g.fromPb(value.Key, "k"),
+			g.pbType(value.Value), g.goType(value.Value), g.fromPb(value.Value, "e"))
+	}
+	return v
+}
+
+// addMessage 添加 message, 名称不能重复
+func (g *protoGen) addMessage(message *protoMessage) error {
+	if g.names[message.Name] {
+		return fmt.Errorf("proto: duplicate message %s", message.Name)
+	}
+	g.names[message.Name] = true
+	g.messages = append(g.messages, message)
+	return nil
+}
+
+// message 生成包内结构体的 message 和转换函数
+func (g *protoGen) message(name string) error {
+	if g.names[name] {
+		return nil
+	}
+	spec := g.p.types[name]
+	st := spec.Type.(*ast.StructType)
+	message := &protoMessage{Name: name}
+	// 先占用名称, 允许递归引用
+	if err := g.addMessage(message); err != nil {
+		return err
+	}
+	goName := g.goType(spec.Name)
+	var toFields, fromFields []string
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return fmt.Errorf("proto: %s: embedded field not supported", name)
+		}
+		for _, fieldName := range field.Names {
+			if !fieldName.IsExported() {
+				continue
+			}
+			typ, err := g.fieldType(field.Type)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, fieldName.Name, err)
+			}
+			protoName := protoFieldName(fieldName.Name)
+			message.Fields = append(message.Fields, &protoField{Name: protoName, Type: typ, Number: len(message.Fields) + 1})
+			pbName := GoCamelCase(protoName)
+			toFields = append(toFields, fmt.Sprintf("\t\t%s: %s,\n", pbName, g.toPb(field.Type, "v."+fieldName.Name)))
+			fromFields = append(fromFields, fmt.Sprintf("\t\t%s: %s,\n", fieldName.Name, g.fromPb(field.Type, "v."+pbName)))
+		}
+	}
+	g.converts = append(g.converts,
+		fmt.Sprintf("func toPb%s(v *%s) *pb.%s {\n\tif v == nil {\n\t\treturn nil\n\t}\n\treturn &pb.%s{\n%s\t}\n}\n\n", name, goName, name, name, strings.Join(toFields, "")),
+		fmt.Sprintf("func fromPb%s(v *pb.%s) *%s {\n\tif v == nil {\n\t\treturn nil\n\t}\n\treturn &%s{\n%s\t}\n}\n\n", name, name, goName, goName, strings.Join(fromFields, "")))
+	return nil
+}
+
+// parseType 解析 FuncDecl 中的类型字符串
+func parseType(typ string) (ast.Expr, error) {
+	return parser.ParseExpr(typ)
+}
+
+// grpcMethod 生成代码需要的方法信息
+type grpcMethod struct {
+	*FuncDecl
+	service string
+	params  []ast.Expr
+	results []ast.Expr
+	stream  ast.Expr
+}
+
+// request/response message 名称, 加服务名前缀避免不同服务的同名方法重复
+func (method *grpcMethod) request() string  { return method.service + method.Name + "Request" }
+func (method *grpcMethod) response() string { return method.service + method.Name + "Response" }
+
+// build 生成所有服务的 message
+func (g *protoGen) build() ([]string, map[string][]*grpcMethod, error) {
+	names, services := g.p.grpcServices()
+	methods := make(map[string][]*grpcMethod)
+	for _, name := range names {
+		for _, decl := range services[name] {
+			method := &grpcMethod{FuncDecl: decl, service: name}
+			request := &protoMessage{Name: method.request()}
+			for _, param := range decl.Params {
+				expr, err := parseType(param.Type)
+				if err != nil {
+					return nil, nil, err
+				}
+				typ, err := g.fieldType(expr)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s.%s: %w", name, decl.Name, err)
+				}
+				method.params = append(method.params, expr)
+				request.Fields = append(request.Fields, &protoField{Name: protoFieldName(param.Name), Type: typ, Number: len(request.Fields) + 1})
+			}
+			if err := g.addMessage(request); err != nil {
+				return nil, nil, err
+			}
+			if decl.Stream != "" {
+				expr, err := parseType(decl.Stream)
+				if err != nil {
+					return nil, nil, err
+				}
+				if star, ok := expr.(*ast.StarExpr); ok {
+					expr = star.X
+				}
+				elem, ok := g.structName(expr)
+				if !ok {
+					return nil, nil, fmt.Errorf("%s.%s: stream element must be a struct", name, decl.Name)
+				}
+				if err := g.message(elem); err != nil {
+					return nil, nil, err
+				}
+				if method.stream, err = parseType(decl.Stream); err != nil {
+					return nil, nil, err
+				}
+			} else {
+				response := &protoMessage{Name: method.response()}
+				for i, ret := range decl.Results {
+					if i == decl.LastResultIndex && ret.Type == "error" {
+						break
+					}
+					expr, err := parseType(ret.Type)
+					if err != nil {
+						return nil, nil, err
+					}
+					typ, err := g.fieldType(expr)
+					if err != nil {
+						return nil, nil, fmt.Errorf("%s.%s: %w", name, decl.Name, err)
+					}
+					method.results = append(method.results, expr)
+					response.Fields = append(response.Fields, &protoField{Name: protoFieldName(ret.Name), Type: typ, Number: len(response.Fields) + 1})
+				}
+				if err := g.addMessage(response); err != nil {
+					return nil, nil, err
+				}
+			}
+			methods[name] = append(methods[name], method)
+		}
+	}
+	return names, methods, nil
+}
+
+// WriteProto 生成 <包名>.proto, goPackage 为 protoc-gen-go 生成代码的导入路径
+// 方法可用 @api grpc=false 排除; time.Time 为 unix 毫秒, ObjectID 为 hex 字符串
+// 字段编号记录在 <包名>.proto.lock 中, 应与 proto 一起提交; 字段类型不兼容的修改返回错误
+func (p *Parser) WriteProto(goPackage, path string) error {
+	g := p.newProtoGen(p.Pkgname)
+	names, methods, err := g.build()
+	if err != nil {
+		return err
+	}
+	lockPath := filepath.Join(path, p.Pkgname+".proto.lock")
+	lock, err := loadProtoLock(lockPath)
+	if err != nil {
+		return err
+	}
+	for _, message := range g.messages {
+		if err = lock.apply(message); err != nil {
+			return err
+		}
+	}
+	builder := &strings.Builder{}
+	builder.WriteString("syntax = \"proto3\";\n\n")
+	builder.WriteString(fmt.Sprintf("package %s;\n\n", p.Pkgname))
+	builder.WriteString(fmt.Sprintf("option go_package = %q;\n", goPackage))
+	for _, message := range g.messages {
+		builder.WriteString(fmt.Sprintf("\nmessage %s {\n", message.Name))
+		for _, field := range message.Fields {
+			builder.WriteString(fmt.Sprintf("  %s %s = %d;\n", field.Type, field.Name, field.Number))
+		}
+		if reserved := message.Reserved; reserved != nil && len(reserved.Numbers) > 0 {
+			numbers := make([]string, len(reserved.Numbers))
+			for i, number := range reserved.Numbers {
+				numbers[i] = strconv.Itoa(number)
+			}
+			builder.WriteString(fmt.Sprintf("  reserved %s;\n", strings.Join(numbers, ", ")))
+		}
+		if reserved := message.Reserved; reserved != nil && len(reserved.Names) > 0 {
+			names := make([]string, len(reserved.Names))
+			for i, name := range reserved.Names {
+				names[i] = strconv.Quote(name)
+			}
+			builder.WriteString(fmt.Sprintf("  reserved %s;\n", strings.Join(names, ", ")))
+		}
+		builder.WriteString("}\n")
+	}
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("\nservice %s {\n", name))
+		for _, method := range methods[name] {
+			for _, comment := range method.Decl.Doc.List {
+				if !strings.Contains(comment.Text, "@api") {
+					builder.WriteString(fmt.Sprintf("  %s\n", comment.Text))
+				}
+			}
+			if method.stream != nil {
+				elem, _ := g.structName(method.stream)
+				if star, ok := method.stream.(*ast.StarExpr); ok {
+					elem, _ = g.structName(star.X)
+				}
+				builder.WriteString(fmt.Sprintf("  rpc %s(%s) returns (stream %s);\n", method.Name, method.request(), elem))
+			} else {
+				builder.WriteString(fmt.Sprintf("  rpc %s(%s) returns (%s);\n", method.Name, method.request(), method.response()))
+			}
+		}
+		builder.WriteString("}\n")
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(path, p.Pkgname+".proto"), []byte(builder.String()), 0644); err != nil {
+		return err
+	}
+	return lock.save(lockPath)
+}
+
+// writeGo 写入生成的 Go 文件, 包含转换函数
+func (g *protoGen) writeGo(pkgname, pbImport, path, filename, body string) error {
+	builder := &strings.Builder{}
+	builder.WriteString("package " + pkgname + "\n\n")
+	builder.WriteString("import (\n")
+	// 标准库在前
+	var std, imports []string
+	for importPath := range g.imports {
+		if strings.Contains(importPath, ".") {
+			imports = append(imports, importPath)
+		} else {
+			std = append(std, importPath)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(imports)
+	for _, importPath := range std {
+		builder.WriteString(fmt.Sprintf("\t%q\n", importPath))
+	}
+	builder.WriteString("\n")
+	for _, importPath := range imports {
+		builder.WriteString(fmt.Sprintf("\t%q\n", importPath))
+	}
+	builder.WriteString(fmt.Sprintf("\tpb %q\n", pbImport))
+	builder.WriteString(")\n\n")
+	builder.WriteString(body)
+	for _, convert := range g.converts {
+		builder.WriteString(convert)
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	fsource, err := format.Source([]byte(builder.String()))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, filename), fsource, 0644)
+}
+
+// writeGrpcInterceptors 生成恢复 panic 并将错误转换为 gRPC 状态码的拦截器
+func writeGrpcInterceptors(builder *strings.Builder, imports map[string]bool) {
+	for _, importPath := range []string{"context", "log/slog", "runtime/debug", "github.com/zdypro888/apigo", "google.golang.org/grpc/codes", "google.golang.org/grpc/status"} {
+		imports[importPath] = true
+	}
+	builder.WriteString(`// GrpcUnaryInterceptor 恢复方法中的 panic, 并将返回的错误按 envelope code 转换为 gRPC 状态码
+//
+//	grpc.NewServer(grpc.ChainUnaryInterceptor(GrpcUnaryInterceptor), grpc.ChainStreamInterceptor(GrpcStreamInterceptor))
+func GrpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer grpcRecover(info.FullMethod, &err)
+	resp, err = handler(ctx, req)
+	return resp, grpcError(err)
+}
+
+// GrpcStreamInterceptor 流方法的 GrpcUnaryInterceptor
+func GrpcStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer grpcRecover(info.FullMethod, &err)
+	return grpcError(handler(srv, stream))
+}
+
+func grpcRecover(method string, err *error) {
+	if recovered := recover(); recovered != nil {
+		slog.Error("grpc: panic recovered", "method", method, "panic", recovered, "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// grpcError 将方法返回的错误转换为 gRPC 状态, 已是 gRPC 状态的错误不变
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Code(apigo.GrpcCode(apigo.ErrorCode(err))), err.Error())
+}
+
+`)
+}
+
+// WriteGrpcServer 生成 grpc_server.go: 将服务适配为 protoc-gen-go-grpc 生成的 pb.<Service>Server
+// pbImport 为 WriteProto 的 goPackage
+// gRPC 调用不经过 Server 的中间件, 生成的 GrpcUnaryInterceptor/GrpcStreamInterceptor 恢复 panic 并转换错误码,
+// 限流、指标和追踪需另外添加 gRPC 拦截器
+func (p *Parser) WriteGrpcServer(pkgname, pbImport, path string) error {
+	g := p.newProtoGen(pkgname)
+	names, methods, err := g.build()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		// 没有 gRPC 服务时不生成, 否则 grpc 和 pb 的导入未使用
+		return nil
+	}
+	g.imports["google.golang.org/grpc"] = true
+	builder := &strings.Builder{}
+	writeGrpcInterceptors(builder, g.imports)
+	for _, name := range names {
+		service := p.Services[name]
+		grpcName := name + "Grpc"
+		implType := name
+		if p.Pkgname != pkgname {
+			implType = p.Pkgname + "." + name
+		}
+		builder.WriteString(fmt.Sprintf("// %s 将 %s 适配为 gRPC 服务\n", grpcName, name))
+		builder.WriteString(fmt.Sprintf("type %s struct {\n\tpb.Unimplemented%sServer\n\t%s %s\n}\n\n", grpcName, name, service.Name, implType))
+		builder.WriteString(fmt.Sprintf("// Register%s 注册服务, server 应使用 GrpcUnaryInterceptor 和 GrpcStreamInterceptor\n", grpcName))
+		builder.WriteString(fmt.Sprintf("func Register%s(server grpc.ServiceRegistrar, impl %s) *%s {\n", grpcName, implType, grpcName))
+		builder.WriteString(fmt.Sprintf("\ts := &%s{%s: impl}\n", grpcName, service.Name))
+		builder.WriteString(fmt.Sprintf("\tpb.Register%sServer(server, s)\n\treturn s\n}\n\n", name))
+		for _, method := range methods[name] {
+			var args []string
+			for i, param := range method.Params {
+				args = append(args, g.fromPb(method.params[i], "req."+GoCamelCase(protoFieldName(param.Name))))
+			}
+			call := func(args []string) string {
+				return fmt.Sprintf("s.%s.%s(%s)", service.Name, method.Name, strings.Join(args, ", "))
+			}
+			if method.stream != nil {
+				builder.WriteString(fmt.Sprintf("func (s *%s) %s(req *pb.%s, stream pb.%s_%sServer) error {\n", grpcName, method.Name, method.request(), name, method.Name))
+				if method.Emitter >= 0 {
+					emit := fmt.Sprintf("func(item %s) error {\n\t\treturn stream.Send(%s)\n\t}", g.goType(method.stream), g.toPb(method.stream, "item"))
+					args = append(args[:method.Emitter:method.Emitter], append([]string{emit}, args[method.Emitter:]...)...)
+					if method.LastResultError {
+						builder.WriteString(fmt.Sprintf("\treturn %s\n", call(args)))
+					} else {
+						builder.WriteString(fmt.Sprintf("\t%s\n\treturn nil\n", call(args)))
+					}
+				} else {
+					if method.LastResultError {
+						builder.WriteString(fmt.Sprintf("\titems, err := %s\n\tif err != nil {\n\t\treturn err\n\t}\n", call(args)))
+					} else {
+						builder.WriteString(fmt.Sprintf("\titems := %s\n", call(args)))
+					}
+					// 提前结束时丢弃剩余的项, 避免生产者阻塞
+					g.imports["github.com/zdypro888/apigo"] = true
+					builder.WriteString("\tfor {\n\t\tselect {\n")
+					builder.WriteString("\t\tcase <-stream.Context().Done():\n\t\t\tgo apigo.Drain(items)\n\t\t\treturn stream.Context().Err()\n")
+					builder.WriteString("\t\tcase item, ok := <-items:\n\t\t\tif !ok {\n\t\t\t\treturn nil\n\t\t\t}\n")
+					builder.WriteString(fmt.Sprintf("\t\t\tif err := stream.Send(%s); err != nil {\n\t\t\t\tgo apigo.Drain(items)\n\t\t\t\treturn err\n\t\t\t}\n", g.toPb(method.stream, "item")))
+					builder.WriteString("\t\t}\n\t}\n")
+				}
+				builder.WriteString("}\n\n")
+				continue
+			}
+			g.imports["context"] = true
+			builder.WriteString(fmt.Sprintf("func (s *%s) %s(ctx context.Context, req *pb.%s) (*pb.%s, error) {\n", grpcName, method.Name, method.request(), method.response()))
+			var rets, fields []string
+			for i, ret := range method.Results {
+				if i == method.LastResultIndex && ret.Type == "error" {
+					rets = append(rets, "err")
+					continue
+				}
+				rets = append(rets, fmt.Sprintf("r%d", i))
+				fields = append(fields, fmt.Sprintf("%s: %s", GoCamelCase(protoFieldName(ret.Name)), g.toPb(method.results[i], fmt.Sprintf("r%d", i))))
+			}
+			switch {
+			case len(rets) == 0:
+				builder.WriteString(fmt.Sprintf("\t%s\n", call(args)))
+			case method.LastResultError && len(rets) == 1:
+				builder.WriteString(fmt.Sprintf("\tif err := %s; err != nil {\n\t\treturn nil, err\n\t}\n", call(args)))
+			default:
+				builder.WriteString(fmt.Sprintf("\t%s := %s\n", strings.Join(rets, ", "), call(args)))
+				if method.LastResultError {
+					builder.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+				}
+			}
+			builder.WriteString(fmt.Sprintf("\treturn &pb.%s{%s}, nil\n}\n\n", method.response(), strings.Join(fields, ", ")))
+		}
+	}
+	return g.writeGo(pkgname, pbImport, path, "grpc_server.go", builder.String())
+}
+
+// WriteGrpcClient 生成 grpc_client.go: 与 WriteClient 相同签名的 gRPC 客户端, 方法增加 ctx 参数
+// 流方法改为 emit 回调, 逐项调用直到流结束
+func (p *Parser) WriteGrpcClient(pkgname, pbImport, path string) error {
+	g := p.newProtoGen(pkgname)
+	// 客户端使用复制的类型
+	g.qualify = false
+	names, methods, err := g.build()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	g.imports["context"] = true
+	g.imports["google.golang.org/grpc"] = true
+	builder := &strings.Builder{}
+	for _, name := range names {
+		clientName := name + "GrpcClient"
+		builder.WriteString(fmt.Sprintf("type %s struct {\n\tclient pb.%sClient\n}\n\n", clientName, name))
+		builder.WriteString(fmt.Sprintf("func New%s(conn grpc.ClientConnInterface) *%s {\n", clientName, clientName))
+		builder.WriteString(fmt.Sprintf("\treturn &%s{client: pb.New%sClient(conn)}\n}\n\n", clientName, name))
+		for _, method := range methods[name] {
+			params := []string{"ctx context.Context"}
+			var fields []string
+			for i, param := range method.Params {
+				params = append(params, fmt.Sprintf("%s %s", param.Name, param.Type))
+				fields = append(fields, fmt.Sprintf("%s: %s", GoCamelCase(protoFieldName(param.Name)), g.toPb(method.params[i], param.Name)))
+			}
+			request := fmt.Sprintf("&pb.%s{%s}", method.request(), strings.Join(fields, ", "))
+			for _, comment := range method.Decl.Doc.List {
+				if !strings.Contains(comment.Text, "@api") {
+					builder.WriteString(comment.Text + "\n")
+				}
+			}
+			if method.stream != nil {
+				g.imports["io"] = true
+				params = append(params, fmt.Sprintf("emit func(%s) error", method.Stream))
+				builder.WriteString(fmt.Sprintf("func (c *%s) %s(%s) error {\n", clientName, method.Name, strings.Join(params, ", ")))
+				builder.WriteString(fmt.Sprintf("\tstream, err := c.client.%s(ctx, %s)\n\tif err != nil {\n\t\treturn err\n\t}\n", method.Name, request))
+				builder.WriteString("\tfor {\n\t\titem, err := stream.Recv()\n")
+				builder.WriteString("\t\tif err == io.EOF {\n\t\t\treturn nil\n\t\t}\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+				builder.WriteString(fmt.Sprintf("\t\tif err := emit(%s); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n}\n\n", g.fromPb(method.stream, "item")))
+				continue
+			}
+			var retTypes, zeros, values []string
+			for i, ret := range method.Results {
+				if i == method.LastResultIndex && ret.Type == "error" {
+					break
+				}
+				retTypes = append(retTypes, ret.Type)
+				zeros = append(zeros, zeroValue(ret.Type))
+				values = append(values, g.fromPb(method.results[i], "resp."+GoCamelCase(protoFieldName(ret.Name))))
+			}
+			retTypes = append(retTypes, "error")
+			builder.WriteString(fmt.Sprintf("func (c *%s) %s(%s) (%s) {\n", clientName, method.Name, strings.Join(params, ", "), strings.Join(retTypes, ", ")))
+			if len(values) == 0 {
+				builder.WriteString(fmt.Sprintf("\t_, err := c.client.%s(ctx, %s)\n\treturn err\n}\n\n", method.Name, request))
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("\tresp, err := c.client.%s(ctx, %s)\n", method.Name, request))
+			builder.WriteString(fmt.Sprintf("\tif err != nil {\n\t\treturn %s, err\n\t}\n", strings.Join(zeros, ", ")))
+			builder.WriteString(fmt.Sprintf("\treturn %s, nil\n}\n\n", strings.Join(values, ", ")))
+		}
+	}
+	return g.writeGo(pkgname, pbImport, path, "grpc_client.go", builder.String())
+}
@@ -0,0 +1,145 @@
+package apigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// protoLock proto 字段编号锁定文件, 与 proto 文件一起提交
+// 已有字段保持编号, 删除的字段编号和名称保留, 不再使用
+type protoLock struct {
+	// Fields "Message.field" 的编号和类型
+	Fields map[string]*protoLockField `json:"fields"`
+	// Reserved 各 message 已删除字段的编号和名称
+	Reserved map[string]*protoReserved `json:"reserved,omitempty"`
+}
+
+type protoLockField struct {
+	Number int    `json:"number"`
+	Type   string `json:"type"`
+}
+
+type protoReserved struct {
+	Numbers []int    `json:"numbers,omitempty"`
+	Names   []string `json:"names,omitempty"`
+}
+
+// loadProtoLock 读取锁定文件, 文件不存在时返回空锁
+func loadProtoLock(path string) (*protoLock, error) {
+	lock := &protoLock{Fields: make(map[string]*protoLockField), Reserved: make(map[string]*protoReserved)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("proto lock %s: %w", path, err)
+	}
+	if lock.Fields == nil {
+		lock.Fields = make(map[string]*protoLockField)
+	}
+	if lock.Reserved == nil {
+		lock.Reserved = make(map[string]*protoReserved)
+	}
+	return lock, nil
+}
+
+func (lock *protoLock) save(path string) error {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	// map<K, V> 不转义
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(lock); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// protoVarints 编码兼容的 varint 类型
+var protoVarints = map[string]bool{"int32": true, "int64": true, "uint32": true, "uint64": true, "bool": true}
+
+// protoCompatible 字段类型从 old 改为 new 后旧数据是否仍可解析
+func protoCompatible(old, new string) bool {
+	if old == new {
+		return true
+	}
+	if protoVarints[old] && protoVarints[new] {
+		return true
+	}
+	return (old == "string" && new == "bytes") || (old == "bytes" && new == "string")
+}
+
+// apply 按锁定文件为 message 的字段编号, 新字段使用未占用的最小编号
+// 锁定中存在而 message 中已删除的字段转为 reserved
+func (lock *protoLock) apply(message *protoMessage) error {
+	prefix := message.Name + "."
+	reserved := lock.Reserved[message.Name]
+	if reserved == nil {
+		reserved = &protoReserved{}
+	}
+	current := make(map[string]bool)
+	for _, field := range message.Fields {
+		current[field.Name] = true
+	}
+	// 已用编号(包括保留的)
+	used := make(map[int]bool)
+	for _, number := range reserved.Numbers {
+		used[number] = true
+	}
+	var removed []string
+	for key, locked := range lock.Fields {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			used[locked.Number] = true
+			if !current[name] {
+				removed = append(removed, name)
+			}
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		reserved.Numbers = append(reserved.Numbers, lock.Fields[prefix+name].Number)
+		reserved.Names = append(reserved.Names, name)
+		delete(lock.Fields, prefix+name)
+	}
+	next := 1
+	for _, field := range message.Fields {
+		if locked, ok := lock.Fields[prefix+field.Name]; ok {
+			if !protoCompatible(locked.Type, field.Type) {
+				return fmt.Errorf("proto: %s.%s changed from %s to %s, rename the field to use a new number", message.Name, field.Name, locked.Type, field.Type)
+			}
+			field.Number = locked.Number
+			locked.Type = field.Type
+			continue
+		}
+		// 重新加入已删除的字段: 名称不再保留, 使用新编号
+		for i, name := range reserved.Names {
+			if name == field.Name {
+				reserved.Names = append(reserved.Names[:i], reserved.Names[i+1:]...)
+				break
+			}
+		}
+		for used[next] || (next >= 19000 && next <= 19999) {
+			// 19000-19999 为 protobuf 保留
+			next++
+		}
+		field.Number = next
+		used[next] = true
+		lock.Fields[prefix+field.Name] = &protoLockField{Number: field.Number, Type: field.Type}
+	}
+	sort.Ints(reserved.Numbers)
+	sort.Strings(reserved.Names)
+	if len(reserved.Numbers) > 0 || len(reserved.Names) > 0 {
+		lock.Reserved[message.Name] = reserved
+	} else {
+		delete(lock.Reserved, message.Name)
+	}
+	message.Reserved = reserved
+	return nil
+}
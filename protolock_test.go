@@ -0,0 +1,147 @@
+package apigo
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtoLockApply(t *testing.T) {
+	type field struct {
+		name, typ string
+	}
+	// full 占用 1..18999 的锁, 新字段应跳过 protobuf 保留的 19000-19999
+	full := map[string]*protoLockField{}
+	var fullFields []field
+	for i := 1; i < 19000; i++ {
+		name := fmt.Sprintf("f%d", i)
+		full["M."+name] = &protoLockField{Number: i, Type: "string"}
+		fullFields = append(fullFields, field{name, "string"})
+	}
+	for _, test := range []struct {
+		name     string
+		fields   map[string]*protoLockField
+		reserved *protoReserved
+		message  []field
+		want     map[string]int
+		// wantReserved 为 nil 时不应有保留
+		wantReserved *protoReserved
+		wantType     string
+		err          string
+	}{
+		{name: "new message", message: []field{{"a", "string"}, {"b", "int64"}}, want: map[string]int{"a": 1, "b": 2}},
+		{name: "reordered fields keep numbers", fields: map[string]*protoLockField{"M.a": {1, "string"}, "M.b": {2, "int64"}},
+			message: []field{{"b", "int64"}, {"a", "string"}}, want: map[string]int{"a": 1, "b": 2}},
+		{name: "other messages ignored", fields: map[string]*protoLockField{"Other.a": {5, "string"}, "MM.a": {7, "string"}},
+			message: []field{{"a", "string"}}, want: map[string]int{"a": 1}},
+		{name: "removed field reserved", fields: map[string]*protoLockField{"M.a": {1, "string"}, "M.b": {2, "int64"}, "M.c": {3, "bool"}},
+			message: []field{{"a", "string"}, {"c", "bool"}}, want: map[string]int{"a": 1, "c": 3},
+			wantReserved: &protoReserved{Numbers: []int{2}, Names: []string{"b"}}},
+		{name: "new field skips reserved number", fields: map[string]*protoLockField{"M.a": {1, "string"}}, reserved: &protoReserved{Numbers: []int{2}, Names: []string{"b"}},
+			message: []field{{"a", "string"}, {"d", "string"}}, want: map[string]int{"a": 1, "d": 3},
+			wantReserved: &protoReserved{Numbers: []int{2}, Names: []string{"b"}}},
+		{name: "re-added field gets a new number", fields: map[string]*protoLockField{"M.a": {1, "string"}}, reserved: &protoReserved{Numbers: []int{2}, Names: []string{"b"}},
+			message: []field{{"a", "string"}, {"b", "int64"}}, want: map[string]int{"a": 1, "b": 3},
+			wantReserved: &protoReserved{Numbers: []int{2}, Names: []string{}}},
+		{name: "compatible varint change", fields: map[string]*protoLockField{"M.a": {1, "int32"}},
+			message: []field{{"a", "int64"}}, want: map[string]int{"a": 1}, wantType: "int64"},
+		{name: "compatible string to bytes", fields: map[string]*protoLockField{"M.a": {1, "string"}},
+			message: []field{{"a", "bytes"}}, want: map[string]int{"a": 1}, wantType: "bytes"},
+		{name: "incompatible change", fields: map[string]*protoLockField{"M.a": {1, "string"}},
+			message: []field{{"a", "int64"}}, err: "changed from string to int64"},
+		{name: "incompatible message type", fields: map[string]*protoLockField{"M.a": {1, "User"}},
+			message: []field{{"a", "repeated User"}}, err: "changed from User to repeated User"},
+		{name: "skip protobuf reserved range", fields: full,
+			message: append(append([]field{}, fullFields...), field{"z", "string"}), want: map[string]int{"f1": 1, "f18999": 18999, "z": 20000}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lock, err := loadProtoLock(filepath.Join(t.TempDir(), "missing.lock"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, locked := range test.fields {
+				copied := *locked
+				lock.Fields[key] = &copied
+			}
+			if test.reserved != nil {
+				copied := *test.reserved
+				copied.Numbers = append([]int(nil), test.reserved.Numbers...)
+				copied.Names = append([]string(nil), test.reserved.Names...)
+				lock.Reserved["M"] = &copied
+			}
+			message := &protoMessage{Name: "M"}
+			for _, f := range test.message {
+				message.Fields = append(message.Fields, &protoField{Name: f.name, Type: f.typ})
+			}
+			err = lock.apply(message)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			numbers := make(map[string]int)
+			for _, f := range message.Fields {
+				numbers[f.Name] = f.Number
+				if lock.Fields["M."+f.Name].Number != f.Number {
+					t.Fatalf("lock %s = %d, field %d", f.Name, lock.Fields["M."+f.Name].Number, f.Number)
+				}
+			}
+			for name, number := range test.want {
+				if numbers[name] != number {
+					t.Fatalf("%s = %d, want %d", name, numbers[name], number)
+				}
+			}
+			if test.wantReserved == nil {
+				if _, ok := lock.Reserved["M"]; ok {
+					t.Fatalf("reserved %+v, want none", lock.Reserved["M"])
+				}
+			} else if got := lock.Reserved["M"]; got == nil || !reflect.DeepEqual(got.Numbers, test.wantReserved.Numbers) ||
+				len(got.Names) != len(test.wantReserved.Names) || (len(got.Names) > 0 && !reflect.DeepEqual(got.Names, test.wantReserved.Names)) {
+				t.Fatalf("reserved %+v, want %+v", got, test.wantReserved)
+			}
+			if test.wantType != "" && lock.Fields["M.a"].Type != test.wantType {
+				t.Fatalf("locked type %s, want %s", lock.Fields["M.a"].Type, test.wantType)
+			}
+			// 其他 message 的字段不变
+			if other, ok := test.fields["Other.a"]; ok && lock.Fields["Other.a"].Number != other.Number {
+				t.Fatalf("Other.a changed to %d", lock.Fields["Other.a"].Number)
+			}
+		})
+	}
+}
+
+func TestProtoLockSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.proto.lock")
+	lock, err := loadProtoLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &protoMessage{Name: "M", Fields: []*protoField{{Name: "a", Type: "string"}, {Name: "tags", Type: "map<string, int64>"}}}
+	if err = lock.apply(first); err != nil {
+		t.Fatal(err)
+	}
+	if err = lock.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadProtoLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 删除 a 后重新生成
+	second := &protoMessage{Name: "M", Fields: []*protoField{{Name: "tags", Type: "map<string, int64>"}, {Name: "b", Type: "bool"}}}
+	if err = loaded.apply(second); err != nil {
+		t.Fatal(err)
+	}
+	if second.Fields[0].Number != 2 || second.Fields[1].Number != 3 {
+		t.Fatalf("numbers %d, %d, want 2, 3", second.Fields[0].Number, second.Fields[1].Number)
+	}
+	if !reflect.DeepEqual(second.Reserved, &protoReserved{Numbers: []int{1}, Names: []string{"a"}}) {
+		t.Fatalf("reserved %+v", second.Reserved)
+	}
+}
@@ -0,0 +1,412 @@
+package apigo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zdypro888/idatabase"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultPageSize 请求未指定每页大小时使用
+	DefaultPageSize = 20
+	// DefaultMaxPageSize 每页大小的默认上限
+	DefaultMaxPageSize = 1000
+)
+
+// QueryOption Query 和 TabulatorQuery 的选项
+type QueryOption func(options *queryOptions)
+
+type queryOptions struct {
+	spec        *QuerySpec
+	maxSize     int
+	cursor      string
+	noCount     bool
+	estimated   bool
+	exportLimit int
+	regexLimit  int
+	database    *mongo.Database
+}
+
+// WithQueryFields 字段白名单, 见 QueryFields
+func WithQueryFields(spec *QuerySpec) QueryOption {
+	return func(options *queryOptions) {
+		options.spec = spec
+	}
+}
+
+// WithMaxPageSize 每页大小上限, 超过时按上限返回
+func WithMaxPageSize(size int) QueryOption {
+	return func(options *queryOptions) {
+		options.maxSize = size
+	}
+}
+
+// WithCursor 使用游标(keyset)分页, field 为唯一且有索引的 bson 字段, 如 _id
+// 请求带上一页返回的 next_cursor 时按排序字段的值定位, 不再使用 skip
+func WithCursor(field string) QueryOption {
+	return func(options *queryOptions) {
+		options.cursor = field
+	}
+}
+
+// WithoutCount 不统计总数(total 为 -1), 多取一行判断是否有下一页, last_page 为估计值
+func WithoutCount() QueryOption {
+	return func(options *queryOptions) {
+		options.noCount = true
+	}
+}
+
+// WithEstimatedCount 没有过滤条件和 selector 时按集合元数据估计总数(EstimatedDocumentCount), 需要 WithDatabase
+// 有条件时仍按条件精确统计
+func WithEstimatedCount() QueryOption {
+	return func(options *queryOptions) {
+		options.estimated = true
+	}
+}
+
+// WithDatabase 查询使用的数据库, 与 collection 同库(可使用 idatabase 的连接)
+// 设置后查询只取字段白名单(未指定时为 T 声明的字段)和排序字段, 并按过滤条件统计总数
+// 未设置时通过 idatabase 查询完整文档再按白名单输出, idatabase 只能统计整个集合,
+// 带过滤条件或 selector 的查询返回 errCountSelector, 需设置 WithDatabase 或 WithoutCount
+func WithDatabase(database *mongo.Database) QueryOption {
+	return func(options *queryOptions) {
+		options.database = database
+	}
+}
+
+// WithRegexFilters 允许 regex 过滤, 按客户端的正则表达式(区分大小写)匹配
+// maxLength: 正则表达式的最大长度, 限制回溯开销; 字段应有合适的索引或只用于小集合
+func WithRegexFilters(maxLength int) QueryOption {
+	return func(options *queryOptions) {
+		options.regexLimit = maxLength
+	}
+}
+
+// WithExportLimit 导出的最大行数, 默认 DefaultExportLimit
+func WithExportLimit(limit int) QueryOption {
+	return func(options *queryOptions) {
+		options.exportLimit = limit
+	}
+}
+
+func newQueryOptions[T any](options []QueryOption) *queryOptions {
+	opts := &queryOptions{maxSize: DefaultMaxPageSize, exportLimit: DefaultExportLimit}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.spec == nil {
+		opts.spec = defaultQuerySpec[T]()
+	}
+	return opts
+}
+
+var (
+	errInvalidPage   = errors.New("invalid page")
+	errCountSelector = errors.New("counting a filtered query requires WithDatabase or WithoutCount")
+)
+
+// QuerySort 排序, Dir 为 asc 或 desc
+type QuerySort struct {
+	Field string `json:"field" bson:"field"`
+	Dir   string `json:"dir" bson:"dir"`
+}
+
+// QueryFilter 过滤条件, Field 为白名单中的列名
+// Type: =, !=, like, notlike, <, <=, >, >=, in, between, regex, starts, ends, empty, notempty
+// regex 需要 WithRegexFilters 开启, 否则返回 400
+// Or 不为空时, 条件为 Or 中任一条件成立
+type QueryFilter struct {
+	Field string        `json:"field" bson:"field"`
+	Type  string        `json:"type" bson:"type"`
+	Value any           `json:"value" bson:"value"`
+	Or    []QueryFilter `json:"or,omitempty" bson:"or,omitempty"`
+}
+
+// QueryRequest 适配器解析出的查询请求
+type QueryRequest struct {
+	// Page 从 1 开始的页码, Offset 为在该页之前额外跳过的行数
+	Page   int
+	Size   int
+	Offset int
+	// Cursor 上一页返回的 NextCursor, 仅在 WithCursor 时使用
+	Cursor  string
+	Sorters []QuerySort
+	Filter  []QueryFilter
+}
+
+// QueryResult 查询结果
+type QueryResult struct {
+	Data       any
+	Total      int64 // 不统计时为 -1
+	LastPage   int
+	NextCursor string
+	// Count 本页的行数
+	Count int
+	// More 是否还有下一页
+	More bool
+}
+
+// sortField 一个排序字段
+type sortField struct {
+	path string
+	dir  int
+}
+
+// runQuery 按白名单、过滤、排序、分页查询, 总数与数据并发查询
+func runQuery[T any](collection string, selector any, page *QueryRequest, opts *queryOptions) (*QueryResult, error) {
+	if page.Size <= 0 {
+		page.Size = DefaultPageSize
+	}
+	if opts.maxSize > 0 && page.Size > opts.maxSize {
+		page.Size = opts.maxSize
+	}
+	if page.Page < 1 {
+		page.Page = 1
+	}
+	if page.Offset < 0 || page.Page > (math.MaxInt32-page.Offset)/page.Size {
+		return nil, errInvalidPage
+	}
+	sorts, err := buildSorts(opts.spec, page.Sorters)
+	if err != nil {
+		return nil, err
+	}
+	if selector, err = buildSelector(opts.spec, page.Filter, selector, opts.regexLimit); err != nil {
+		return nil, err
+	}
+	query := &idatabase.QueryAny[T]{}
+	query.Collection = collection
+	query.Limit = page.Size
+	query.Sorts = sorts
+	dataSelector := selector
+	if opts.cursor != "" {
+		keys := cursorSorts(sorts, opts.cursor)
+		query.Sorts = nil
+		for _, key := range keys {
+			query.Sorts = append(query.Sorts, bson.E{Key: key.path, Value: key.dir})
+		}
+		if page.Cursor != "" {
+			condition, err := cursorCondition(keys, page.Cursor)
+			if err != nil {
+				return nil, err
+			}
+			dataSelector = mergeSelector(selector, []bson.E{{Key: "$or", Value: condition}})
+		}
+	}
+	if page.Cursor == "" {
+		query.Skip = page.Offset + (page.Page-1)*page.Size
+	}
+	// idatabase 的 Count 不带条件, 有条件时需要 WithDatabase
+	if !opts.noCount && opts.database == nil && !emptySelector(selector) {
+		return nil, errCountSelector
+	}
+	if opts.noCount || opts.cursor != "" {
+		// 多取一行判断是否有下一页
+		query.Limit = page.Size + 1
+	}
+	query.Check()
+	result := &QueryResult{Total: -1}
+	var objects []T
+	var countErr, selectErr error
+	var wg sync.WaitGroup
+	if !opts.noCount {
+		// 与 Select 并发, 使用独立的副本
+		count := *query
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch {
+			case opts.database == nil:
+				result.Total, countErr = count.Count()
+			case opts.estimated && emptySelector(selector):
+				result.Total, countErr = opts.database.Collection(collection).EstimatedDocumentCount(context.Background())
+			default:
+				result.Total, countErr = opts.database.Collection(collection).CountDocuments(context.Background(), mongoFilter(selector))
+			}
+		}()
+	}
+	objects, selectErr = selectObjects(opts, query, dataSelector)
+	wg.Wait()
+	if selectErr != nil {
+		return nil, selectErr
+	}
+	if countErr != nil {
+		return nil, countErr
+	}
+	more := len(objects) > page.Size
+	if more {
+		objects = objects[:page.Size]
+	}
+	result.Count = len(objects)
+	result.More = more
+	if result.Total >= 0 && opts.cursor == "" {
+		result.More = int64(query.Skip+len(objects)) < result.Total
+	}
+	if opts.cursor != "" && more && len(objects) > 0 {
+		if result.NextCursor, err = encodeCursor(objects[len(objects)-1], cursorSorts(sorts, opts.cursor)); err != nil {
+			return nil, err
+		}
+	}
+	if result.Total >= 0 {
+		result.LastPage = int(math.Ceil(float64(result.Total) / float64(page.Size)))
+	} else if more {
+		result.LastPage = page.Page + 1
+	} else {
+		result.LastPage = page.Page
+	}
+	if result.Data, err = projectAll(opts.spec, objects); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// selectObjects 设置了 WithDatabase 时只取白名单和排序字段, 否则通过 idatabase 查询完整文档
+func selectObjects[T any](opts *queryOptions, query *idatabase.QueryAny[T], selector any) ([]T, error) {
+	if opts.database == nil {
+		return query.Select(selector)
+	}
+	sorts := make([]string, 0, len(query.Sorts))
+	for _, sort := range query.Sorts {
+		sorts = append(sorts, sort.Key)
+	}
+	findOptions := options.Find().SetSkip(int64(query.Skip)).SetLimit(int64(query.Limit))
+	if projection := opts.spec.projection(sorts...); len(projection) > 0 {
+		findOptions.SetProjection(projection)
+	}
+	if len(query.Sorts) > 0 {
+		findOptions.SetSort(query.Sorts)
+	}
+	ctx := context.Background()
+	cursor, err := opts.database.Collection(query.Collection).Find(ctx, mongoFilter(selector), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var objects []T
+	if err = cursor.All(ctx, &objects); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// emptySelector selector 是否没有任何条件
+func emptySelector(selector any) bool {
+	switch selector := selector.(type) {
+	case nil:
+		return true
+	case bson.D:
+		return len(selector) == 0
+	case bson.M:
+		return len(selector) == 0
+	case map[string]any:
+		return len(selector) == 0
+	}
+	return false
+}
+
+// mongoFilter 驱动不接受 nil 条件
+func mongoFilter(selector any) any {
+	if selector == nil {
+		return bson.D{}
+	}
+	return selector
+}
+
+// cursorSorts 在排序后追加游标字段, 保证排序唯一
+func cursorSorts(sorts bson.D, cursor string) []sortField {
+	keys := make([]sortField, 0, len(sorts)+1)
+	unique := false
+	for _, sort := range sorts {
+		keys = append(keys, sortField{path: sort.Key, dir: sort.Value.(int)})
+		if sort.Key == cursor {
+			unique = true
+			break
+		}
+	}
+	if !unique {
+		keys = append(keys, sortField{path: cursor, dir: 1})
+	}
+	return keys
+}
+
+type cursorValues struct {
+	Values []bson.RawValue `bson:"v"`
+}
+
+// encodeCursor 记录最后一行的排序字段值
+func encodeCursor(object any, keys []sortField) (string, error) {
+	raw, err := bson.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	var cursor cursorValues
+	for _, key := range keys {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(key.path, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	data, err := bson.Marshal(&cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// cursorCondition 游标之后的行: (k1 > v1) or (k1 = v1 and k2 > v2) ...
+func cursorCondition(keys []sortField, encoded string) (bson.A, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor: %w", errQuery, err)
+	}
+	var cursor cursorValues
+	if err = bson.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: cursor", errQuery)
+	}
+	var conditions bson.A
+	for i, key := range keys {
+		condition := bson.D{}
+		for j := 0; j < i; j++ {
+			condition = append(condition, bson.E{Key: keys[j].path, Value: cursor.Values[j]})
+		}
+		operator := "$gt"
+		if key.dir < 0 {
+			operator = "$lt"
+		}
+		condition = append(condition, bson.E{Key: key.path, Value: bson.M{operator: cursor.Values[i]}})
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// QueryAdapter 表格协议适配器: 解析请求并按协议输出结果
+type QueryAdapter interface {
+	Parse(ctx *gin.Context) (*QueryRequest, error)
+	Write(ctx *gin.Context, request *QueryRequest, result *QueryResult)
+}
+
+// Query 通用查询接口, 由 adapter 决定请求和响应格式, 过滤、排序、投影和分页共用同一实现
+// adapter: TabulatorAdapter, AGGridAdapter, QueryStringAdapter 或自定义实现
+func Query[T any](ctx *gin.Context, adapter QueryAdapter, collection string, selector any, options ...QueryOption) {
+	request, err := adapter.Parse(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	result, err := runQuery[T](collection, selector, request, newQueryOptions[T](options))
+	if err != nil {
+		ctx.AbortWithError(queryStatus(err), err)
+		return
+	}
+	adapter.Write(ctx, request, result)
+}
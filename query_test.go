@@ -0,0 +1,117 @@
+package apigo
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type queryRow struct {
+	ID   int    `bson:"_id"`
+	Name string `bson:"name"`
+	Age  int    `bson:"age"`
+}
+
+func TestCursorSorts(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		sorts bson.D
+		want  []sortField
+	}{
+		{name: "append cursor", sorts: bson.D{{Key: "age", Value: -1}}, want: []sortField{{"age", -1}, {"_id", 1}}},
+		{name: "cursor sorted", sorts: bson.D{{Key: "_id", Value: -1}, {Key: "age", Value: 1}}, want: []sortField{{"_id", -1}}},
+		{name: "no sorts", want: []sortField{{"_id", 1}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cursorSorts(test.sorts, "_id"); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("keys %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCursorCondition(t *testing.T) {
+	row := &queryRow{ID: 7, Name: "bob", Age: 30}
+	for _, test := range []struct {
+		name string
+		keys []sortField
+		want string
+	}{
+		{name: "single", keys: []sortField{{"_id", 1}},
+			want: `{"c":[{"_id":{"$gt":{"$numberInt":"7"}}}]}`},
+		{name: "descending with tie breaker", keys: []sortField{{"age", -1}, {"_id", 1}},
+			want: `{"c":[{"age":{"$lt":{"$numberInt":"30"}}},{"age":{"$numberInt":"30"},"_id":{"$gt":{"$numberInt":"7"}}}]}`},
+		{name: "missing field is null", keys: []sortField{{"profile.city", 1}, {"_id", 1}},
+			want: `{"c":[{"profile.city":{"$gt":null}},{"profile.city":null,"_id":{"$gt":{"$numberInt":"7"}}}]}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := encodeCursor(row, test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			condition, err := cursorCondition(test.keys, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := bson.MarshalExtJSON(bson.D{{Key: "c", Value: condition}}, true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Fatalf("condition %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCursorConditionInvalid(t *testing.T) {
+	keys := []sortField{{"age", 1}, {"_id", 1}}
+	short, err := encodeCursor(&queryRow{ID: 1}, keys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cursor := range []string{"!!", "AAAA", short} {
+		if _, err := cursorCondition(keys, cursor); !errors.Is(err, errQuery) {
+			t.Fatalf("cursor %q: error %v, want errQuery", cursor, err)
+		}
+	}
+}
+
+func TestRunQueryPageBounds(t *testing.T) {
+	// 通过边界检查的请求在统计时返回 errCountSelector(没有 WithDatabase), 不会访问数据库
+	selector := bson.M{"owner": "bob"}
+	for _, test := range []struct {
+		name     string
+		page     QueryRequest
+		maxSize  int
+		wantSize int
+		wantPage int
+		err      error
+	}{
+		{name: "defaults", page: QueryRequest{}, wantSize: DefaultPageSize, wantPage: 1, err: errCountSelector},
+		{name: "clamped size", page: QueryRequest{Page: 2, Size: 5000}, maxSize: 100, wantSize: 100, wantPage: 2, err: errCountSelector},
+		{name: "negative page", page: QueryRequest{Page: -3, Size: 10}, wantSize: 10, wantPage: 1, err: errCountSelector},
+		{name: "page overflow", page: QueryRequest{Page: math.MaxInt32, Size: 10}, wantSize: 10, wantPage: math.MaxInt32, err: errInvalidPage},
+		{name: "negative offset", page: QueryRequest{Page: 1, Size: 10, Offset: -1}, wantSize: 10, wantPage: 1, err: errInvalidPage},
+		{name: "offset overflow", page: QueryRequest{Page: 2, Size: 10, Offset: math.MaxInt32 - 15}, wantSize: 10, wantPage: 2, err: errInvalidPage},
+		{name: "unknown sort", page: QueryRequest{Sorters: []QuerySort{{Field: "secret"}}}, wantSize: DefaultPageSize, wantPage: 1, err: errQuery},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			options := []QueryOption{WithQueryFields(QueryFields[queryRow]("_id", "name", "age"))}
+			if test.maxSize > 0 {
+				options = append(options, WithMaxPageSize(test.maxSize))
+			}
+			page := test.page
+			_, err := runQuery[queryRow]("rows", selector, &page, newQueryOptions[queryRow](options))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if page.Size != test.wantSize || page.Page != test.wantPage {
+				t.Fatalf("page %d size %d, want page %d size %d", page.Page, page.Size, test.wantPage, test.wantSize)
+			}
+		})
+	}
+}
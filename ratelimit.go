@@ -0,0 +1,223 @@
+package apigo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate 令牌桶速率: 每 Per 时间补充 Limit 个令牌, 最多累积 Burst 个
+type Rate struct {
+	Limit float64
+	Per   time.Duration
+	Burst int
+}
+
+func (rate Rate) perSecond() float64 {
+	return rate.Limit / rate.Per.Seconds()
+}
+
+func (rate Rate) capacity() float64 {
+	if rate.Burst > 0 {
+		return float64(rate.Burst)
+	}
+	return math.Max(1, math.Ceil(rate.Limit))
+}
+
+// ParseRate 解析 "10/s", "100/m", "1000/h" 格式的速率
+func ParseRate(value string) (Rate, error) {
+	limit, unit, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q", value)
+	}
+	n, err := strconv.ParseFloat(limit, 64)
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", value)
+	}
+	rate := Rate{Limit: n}
+	switch unit {
+	case "s", "sec", "second":
+		rate.Per = time.Second
+	case "m", "min", "minute":
+		rate.Per = time.Minute
+	case "h", "hour":
+		rate.Per = time.Hour
+	default:
+		if rate.Per, err = time.ParseDuration(unit); err != nil || rate.Per <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate unit %q", unit)
+		}
+	}
+	return rate, nil
+}
+
+// HandleOption HandleAPI 选项
+type HandleOption func(api *APIMethod)
+
+// WithRateLimit 设置方法的速率限制, rate 格式见 ParseRate, 对应 @api ratelimit=10/s burst=20
+func WithRateLimit(rate string, burst int) HandleOption {
+	r, err := ParseRate(rate)
+	if err != nil {
+		panic(err)
+	}
+	r.Burst = burst
+	return func(api *APIMethod) {
+		api.RateLimit = &r
+	}
+}
+
+// RateLimitStore 令牌桶存储, 可替换为共享存储以在多个实例间限流
+type RateLimitStore interface {
+	// Take 从 key 对应的桶中取出一个令牌, 不足时返回需要等待的时间
+	Take(key string, rate Rate, now time.Time) (bool, time.Duration, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimitStore 进程内令牌桶
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweep   time.Time
+}
+
+// NewMemoryRateLimitStore 创建内存存储
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (store *MemoryRateLimitStore) Take(key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	capacity := rate.capacity()
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		store.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+elapsed.Seconds()*rate.perSecond())
+		bucket.last = now
+	}
+	store.cleanup(now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - bucket.tokens) / rate.perSecond() * float64(time.Second))
+	return false, wait, nil
+}
+
+// cleanup 定期删除长时间未使用的桶
+func (store *MemoryRateLimitStore) cleanup(now time.Time) {
+	if now.Sub(store.sweep) < time.Minute {
+		return
+	}
+	store.sweep = now
+	for key, bucket := range store.buckets {
+		if now.Sub(bucket.last) > time.Hour {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+// RateLimitKeyFunc 返回限流的调用方标识
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// KeyByIP 按客户端 IP 限流
+func KeyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// KeyByHeader 按请求头(如 API key)限流, 没有请求头时按 IP
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *gin.Context) string {
+		if value := ctx.GetHeader(name); value != "" {
+			return "key:" + value
+		}
+		return KeyByIP(ctx)
+	}
+}
+
+// KeyByPrincipal 按 SetPrincipal 设置的调用方限流, 未认证时按 IP
+func KeyByPrincipal(ctx *gin.Context) string {
+	if principal := Principal(ctx); principal != "" {
+		return "principal:" + principal
+	}
+	return KeyByIP(ctx)
+}
+
+const principalKey = "apigo.principal"
+
+// SetPrincipal 由认证中间件设置当前调用方
+func SetPrincipal(ctx *gin.Context, principal string) {
+	ctx.Set(principalKey, principal)
+}
+
+// Principal 返回当前调用方, 未认证时为空
+func Principal(ctx *gin.Context) string {
+	return ctx.GetString(principalKey)
+}
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// RateLimiter 限流配置
+type RateLimiter struct {
+	Store RateLimitStore
+	Key   RateLimitKeyFunc
+	// Default 可选, 没有配置 ratelimit 的路由使用的速率
+	Default *Rate
+	// Code 超出限制时返回的错误码
+	Code int
+}
+
+// NewRateLimiter 创建使用内存存储、按 IP 限流的 RateLimiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Store: NewMemoryRateLimitStore(),
+		Key:   KeyByIP,
+		Code:  http.StatusTooManyRequests,
+	}
+}
+
+// EnableRateLimit 开启限流, 作用于 HandleAPI、HandleGet 和 HandlePost 注册的路由
+func (s *Server) EnableRateLimit(limiter *RateLimiter) {
+	s.limiter = limiter
+}
+
+// rateLimit 按方法速率或默认速率限流, 在路由中执行以便读取认证中间件设置的 Principal
+func (s *Server) rateLimit(ctx *gin.Context) {
+	limiter := s.limiter
+	if limiter == nil {
+		return
+	}
+	rate := limiter.Default
+	bucket := "*"
+	if api := s.LookupAPI(ctx); api != nil && api.RateLimit != nil {
+		rate = api.RateLimit
+		bucket = api.Service + "." + api.Method
+	}
+	if rate == nil {
+		return
+	}
+	ok, wait, err := limiter.Store.Take(limiter.Key(ctx)+"|"+bucket, *rate, time.Now())
+	if err != nil {
+		// 存储不可用时放行
+		ctx.Error(err)
+		return
+	}
+	if !ok {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		s.ResponseError(ctx, limiter.Code, errRateLimited)
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,42 @@
+package apigo
+
+import (
+	"errors"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PanicReporter 接收 handler 中恢复的 panic, 可用于上报到外部系统
+type PanicReporter func(ctx *gin.Context, recovered any, stack []byte)
+
+var errPanic = errors.New("internal server error")
+
+// recovery 将 handler 中的 panic 转换为 {code, error} 消息
+func (s *Server) recovery(ctx *gin.Context) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		stack := debug.Stack()
+		slog.Error("apigo: panic recovered",
+			"request_id", RequestID(ctx),
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"panic", recovered,
+			"stack", string(stack),
+		)
+		if s.PanicReporter != nil {
+			s.PanicReporter(ctx, recovered, stack)
+		}
+		if ctx.Writer.Written() {
+			ctx.Abort()
+			return
+		}
+		s.ResponseError(ctx, s.PanicCode, errPanic)
+		ctx.Abort()
+	}()
+	ctx.Next()
+}
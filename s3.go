@@ -0,0 +1,51 @@
+package apigo
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/tus/tusd/pkg/s3store"
+)
+
+// S3Config S3 兼容存储(AWS S3、MinIO 等)的连接配置
+type S3Config struct {
+	// Endpoint 兼容存储的地址, 如 http://127.0.0.1:9000, 使用 AWS S3 时为空
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	// Prefix 对象 key 的前缀, 如 uploads/
+	Prefix string
+}
+
+// NewS3Store 创建 S3 兼容存储, 上传以分片上传(multipart upload)写入 Bucket
+// S3 没有锁, TusdUploadStore 默认使用 memorylocker, 多进程部署时通过 WithTusdLocker 设置共享的锁
+// S3 不能列出上传, WithTusdExpiration 不会清理过期上传, 应使用 bucket 的生命周期规则
+func NewS3Store(config S3Config) (s3store.S3Store, error) {
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	cfg := aws.NewConfig().WithRegion(region)
+	if config.Endpoint != "" {
+		// 兼容存储通常只支持路径方式访问 bucket
+		cfg = cfg.WithEndpoint(config.Endpoint).WithS3ForcePathStyle(true)
+	}
+	if config.AccessKey != "" {
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""))
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return s3store.S3Store{}, err
+	}
+	return NewS3StoreWithService(config.Bucket, config.Prefix, s3.New(sess)), nil
+}
+
+// NewS3StoreWithService 使用已有的 S3 客户端创建存储
+func NewS3StoreWithService(bucket, prefix string, service s3store.S3API) s3store.S3Store {
+	store := s3store.New(bucket, service)
+	store.ObjectPrefix = prefix
+	return store
+}
@@ -0,0 +1,226 @@
+package apigo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 内存中的 S3 兼容存储, 只实现 s3store 使用的接口
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int64][]byte
+	nextID  int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int64][]byte)}
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx context.Context, input *s3.PutObjectInput, opt ...request.Option) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[*input.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) ListPartsWithContext(ctx context.Context, input *s3.ListPartsInput, opt ...request.Option) (*s3.ListPartsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[*input.UploadId]
+	if !ok {
+		return nil, awserr.New("NoSuchUpload", "upload not found", nil)
+	}
+	output := &s3.ListPartsOutput{IsTruncated: aws.Bool(false)}
+	for number, data := range parts {
+		output.Parts = append(output.Parts, &s3.Part{PartNumber: aws.Int64(number), Size: aws.Int64(int64(len(data))), ETag: aws.String(fmt.Sprint(number))})
+	}
+	sort.Slice(output.Parts, func(i, j int) bool {
+		return *output.Parts[i].PartNumber < *output.Parts[j].PartNumber
+	})
+	return output, nil
+}
+
+func (f *fakeS3) UploadPartWithContext(ctx context.Context, input *s3.UploadPartInput, opt ...request.Option) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[*input.UploadId]
+	if !ok {
+		return nil, awserr.New("NoSuchUpload", "upload not found", nil)
+	}
+	parts[*input.PartNumber] = data
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprint(*input.PartNumber))}, nil
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx context.Context, input *s3.GetObjectInput, opt ...request.Option) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "object not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ContentLength: aws.Int64(int64(len(data)))}, nil
+}
+
+func (f *fakeS3) CreateMultipartUploadWithContext(ctx context.Context, input *s3.CreateMultipartUploadInput, opt ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("multipart%d", f.nextID)
+	f.uploads[id] = make(map[int64][]byte)
+	return &s3.CreateMultipartUploadOutput{Bucket: input.Bucket, Key: input.Key, UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) AbortMultipartUploadWithContext(ctx context.Context, input *s3.AbortMultipartUploadInput, opt ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.uploads[*input.UploadId]; !ok {
+		return nil, awserr.New("NoSuchUpload", "upload not found", nil)
+	}
+	delete(f.uploads, *input.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjectWithContext(ctx context.Context, input *s3.DeleteObjectInput, opt ...request.Option) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx context.Context, input *s3.DeleteObjectsInput, opt ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, object := range input.Delete.Objects {
+		delete(f.objects, *object.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUploadWithContext(ctx context.Context, input *s3.CompleteMultipartUploadInput, opt ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[*input.UploadId]
+	if !ok {
+		return nil, awserr.New("NoSuchUpload", "upload not found", nil)
+	}
+	var data []byte
+	for _, part := range input.MultipartUpload.Parts {
+		data = append(data, parts[*part.PartNumber]...)
+	}
+	f.objects[*input.Key] = data
+	delete(f.uploads, *input.UploadId)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) UploadPartCopyWithContext(ctx context.Context, input *s3.UploadPartCopyInput, opt ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, key, _ := strings.Cut(*input.CopySource, "/")
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "object not found", nil)
+	}
+	parts, ok := f.uploads[*input.UploadId]
+	if !ok {
+		return nil, awserr.New("NoSuchUpload", "upload not found", nil)
+	}
+	parts[*input.PartNumber] = data
+	return &s3.UploadPartCopyOutput{}, nil
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	return data, ok
+}
+
+func tusRequest(t *testing.T, s *Server, method, target string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	request.Header.Set("Tus-Resumable", "1.0.0")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	s.App.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3()
+	s := NewServer()
+	defer s.Close()
+	endpoint, err := s.TusdUploadStore(NewS3StoreWithService("bucket", "uploads/", fake), "/files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !endpoint.composer.UsesLocker {
+		t.Fatal("s3 store should be used with a locker")
+	}
+	content := []byte("hello world")
+	created := tusRequest(t, s, http.MethodPost, "/files/", nil, map[string]string{"Upload-Length": fmt.Sprint(len(content))})
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", created.Code, created.Body)
+	}
+	location := created.Header().Get("Location")
+	id := path.Base(location)
+	uploadID, _, _ := strings.Cut(id, "+")
+
+	// 分两次写入, 第一次小于 MinPartSize, 暂存为 .part 对象
+	for _, chunk := range []struct {
+		offset int
+		data   []byte
+	}{
+		{0, content[:5]},
+		{5, content[5:]},
+	} {
+		patched := tusRequest(t, s, http.MethodPatch, "/files/"+id, chunk.data, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": fmt.Sprint(chunk.offset),
+		})
+		if patched.Code != http.StatusNoContent {
+			t.Fatalf("patch at %d: status %d: %s", chunk.offset, patched.Code, patched.Body)
+		}
+	}
+	head := tusRequest(t, s, http.MethodHead, "/files/"+id, nil, nil)
+	if offset := head.Header().Get("Upload-Offset"); offset != fmt.Sprint(len(content)) {
+		t.Fatalf("offset %s, want %d", offset, len(content))
+	}
+	if data, ok := fake.object("uploads/" + uploadID); !ok || !bytes.Equal(data, content) {
+		t.Fatalf("object %q, want %q", data, content)
+	}
+
+	deleted := tusRequest(t, s, http.MethodDelete, "/files/"+id, nil, nil)
+	if deleted.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", deleted.Code, deleted.Body)
+	}
+	for _, key := range []string{"uploads/" + uploadID, "uploads/" + uploadID + ".info"} {
+		if _, ok := fake.object(key); ok {
+			t.Fatalf("%s not deleted", key)
+		}
+	}
+}
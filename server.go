@@ -1,12 +1,11 @@
 package apigo
 
 import (
-	"context"
-	"io"
-	"math"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"path"
+	"strings"
+	"sync"
 
 	brotli "github.com/anargu/gin-brotli"
 	"github.com/gin-contrib/cors"
@@ -14,9 +13,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kardianos/osext"
 	"github.com/quic-go/quic-go/http3"
-	"github.com/tus/tusd/pkg/filestore"
-	tusd "github.com/tus/tusd/pkg/handler"
-	"github.com/zdypro888/idatabase"
 	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/acme/autocert"
 )
@@ -47,25 +43,98 @@ func (msg *messageBSON) UnmarshalJSON(data []byte) error {
 	return bson.UnmarshalExtJSON(data, false, msg)
 }
 
-type TusdHandle func(ctx *gin.Context, reader io.Reader, info *tusd.FileInfo) (any, error)
 type Server struct {
-	App       *gin.Engine
-	WithBSON  bool
-	filestore *filestore.FileStore
-	composer  *tusd.StoreComposer
+	App      *gin.Engine
+	WithBSON bool
+	// PanicCode handler 发生 panic 时返回的错误码
+	PanicCode int
+	// PanicReporter 可选, 接收恢复的 panic
+	PanicReporter PanicReporter
+	// Logger 访问日志, 为空时使用 slog.Default()
+	Logger *slog.Logger
+	// Tracer 可选, 开启后为每个请求创建 span
+	Tracer *Tracer
+	// AllowOrigins 允许的跨域来源, 如 "https://example.com", "*" 为所有来源
+	// 为空时 CORS 允许所有来源(不带 cookie), WebSocket 只允许同源
+	AllowOrigins  []string
+	metrics       *Metrics
+	limiter       *RateLimiter
+	apis          map[string]*APIMethod
+	calls         map[string]string
+	tusdEndpoints []*TusdEndpoint
+	sockets       map[*Socket]struct{}
+	socketsMutex  sync.Mutex
+}
+
+// APIMethod 生成的 @api 方法信息
+type APIMethod struct {
+	Service string
+	Method  string
+	// RateLimit 可选, 方法的速率限制
+	RateLimit *Rate
+	// Params 参数名, 用于 JSON-RPC 按位置传参
+	Params []string
+	// Stream SSE 流方法, 不能通过批量、JSON-RPC 和 WebSocket 调用
+	Stream bool
+}
+
+// WithParams 设置方法的参数名, 顺序与方法声明一致
+func WithParams(names ...string) HandleOption {
+	return func(api *APIMethod) {
+		api.Params = names
+	}
+}
+
+// WithStream 标记方法为 SSE 流
+func WithStream() HandleOption {
+	return func(api *APIMethod) {
+		api.Stream = true
+	}
 }
 
 func NewServer() *Server {
-	app := gin.Default()
+	app := gin.New()
+	s := &Server{
+		App:       app,
+		WithBSON:  true,
+		PanicCode: http.StatusInternalServerError,
+		apis:      make(map[string]*APIMethod),
+		calls:     make(map[string]string),
+		sockets:   make(map[*Socket]struct{}),
+	}
+	// 默认不信任代理, ClientIP 为连接地址; 部署在反向代理后时用 App.SetTrustedProxies 设置代理地址
+	app.SetTrustedProxies(nil)
+	app.Use(gin.Recovery(), s.requestID, s.trace, s.accessLog, s.observeMetrics)
 	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
+	config.AllowOriginFunc = func(origin string) bool {
+		return len(s.AllowOrigins) == 0 || s.allowOrigin(origin)
+	}
+	config.AddAllowHeaders(RequestIDHeader, TraceparentHeader)
+	config.AddAllowHeaders(tusdAllowHeaders...)
+	config.AddExposeHeaders(RequestIDHeader, "Retry-After")
+	config.AddExposeHeaders(tusdExposeHeaders...)
 	app.Use(cors.New(config))
 	// app.Use(gzip.Gzip(gzip.DefaultCompression))
-	app.Use(brotli.Brotli(brotli.DefaultCompression))
-	return &Server{
-		App:      app,
-		WithBSON: true,
+	compress := brotli.Brotli(brotli.DefaultCompression)
+	app.Use(func(ctx *gin.Context) {
+		// SSE 每个事件需立即 flush, 压缩会缓存输出
+		if strings.Contains(ctx.GetHeader("Accept"), "text/event-stream") {
+			return
+		}
+		compress(ctx)
+	})
+	app.Use(s.recovery)
+	return s
+}
+
+// allowOrigin origin 是否在 AllowOrigins 中
+func (s *Server) allowOrigin(origin string) bool {
+	for _, allowed := range s.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
 	}
+	return false
 }
 
 // Static add Cross-Origin-Opener-Policy: same-origin and Cross-Origin-Embedder-Policy: require-corp to all routers
@@ -79,139 +148,6 @@ func (s *Server) Static(relativePath string, root string) {
 	router.Use(crossHandle)
 }
 
-// TusdUpload handle upload request
-// store: upload file store path
-// path: upload request path. eg: /upload/
-func (s *Server) TusdUpload(store, path string) error {
-	if s.composer == nil || s.filestore == nil {
-		s.filestore = &filestore.FileStore{Path: store}
-		s.composer = tusd.NewStoreComposer()
-		s.filestore.UseIn(s.composer)
-	}
-	handler, err := tusd.NewHandler(tusd.Config{
-		BasePath:      path,
-		StoreComposer: s.composer,
-	})
-	if err == nil {
-		stripHandle := http.StripPrefix(path, handler)
-		s.App.Use(gin.WrapH(stripHandle))
-	}
-	return err
-}
-
-type tusdRequest struct {
-	URLs  []string `json:"urls"`
-	Extra any      `json:"tag"`
-}
-
-type tusdResponse struct {
-	Success map[string]any    `json:"success"`
-	Failed  map[string]string `json:"failed"`
-}
-
-func (s *Server) tusdUploaded(ctx *gin.Context, handle TusdHandle) {
-	var err error
-	var request tusdRequest
-	if err = ctx.BindJSON(&request); err != nil {
-		ctx.AbortWithError(http.StatusBadRequest, err)
-		return
-	}
-	response := &tusdResponse{}
-	for _, URL := range request.URLs {
-		var u *url.URL
-		if u, err = url.Parse(URL); err == nil {
-			fileID := path.Base(u.Path)
-			var upload tusd.Upload
-			if upload, err = s.filestore.GetUpload(context.Background(), fileID); err == nil {
-				var reader io.Reader
-				if reader, err = upload.GetReader(context.Background()); err == nil {
-					var result any
-					var fileInfo tusd.FileInfo
-					if fileInfo, err = upload.GetInfo(context.Background()); err != nil {
-						result, err = handle(ctx, reader, nil)
-					} else {
-						result, err = handle(ctx, reader, &fileInfo)
-					}
-					if err == nil {
-						response.Success[URL] = result
-					}
-				}
-			}
-		}
-		if err != nil {
-			response.Failed[URL] = err.Error()
-		}
-	}
-	ctx.JSON(http.StatusOK, response)
-}
-
-func (s *Server) TusdHandle(path string, handle TusdHandle) {
-	s.App.POST(path, func(ctx *gin.Context) {
-		s.tusdUploaded(ctx, handle)
-	})
-}
-
-type tabulatorSort struct {
-	Field string `json:"field"`
-	Dir   string `json:"dir"`
-}
-type tabulatorFilter struct {
-	Field string `json:"field"`
-	Type  string `json:"type"`
-	Value string `json:"value"`
-}
-type tabulatorRequest struct {
-	Page    int               `json:"page"`   // page - the page number being requested
-	Size    int               `json:"size"`   // size - the number of rows to a page (if paginationSize is set)
-	Sorters []tabulatorSort   `json:"sort"`   // sorters - the first current sorters(if any)
-	Filter  []tabulatorFilter `json:"filter"` // filter - an array of the current filters (if any)
-}
-type tabulatorResponse struct {
-	LastPage int `bson:"last_page" json:"last_page"`
-	Data     any `bson:"data" json:"data"`
-}
-
-// MarshalJSON 格式化
-func (response *tabulatorResponse) MarshalJSON() ([]byte, error) {
-	return bson.MarshalExtJSON(response, false, true)
-}
-
-// UnmarshalJSON 读取
-func (response *tabulatorResponse) UnmarshalJSON(data []byte) error {
-	return bson.UnmarshalExtJSON(data, false, response)
-}
-
-func TabulatorQuery[T any](ctx *gin.Context, collection string, selector any) {
-	var pagination tabulatorRequest
-	if err := ctx.BindJSON(&pagination); err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, err)
-	} else {
-		query := &idatabase.QueryAny[T]{}
-		query.Collection = collection
-		query.Skip = (pagination.Page - 1) * pagination.Size
-		query.Limit = pagination.Size
-		for _, sort := range pagination.Sorters {
-			sortValue := -1
-			if sort.Dir == "asc" {
-				sortValue = 1
-			}
-			query.Sorts = append(query.Sorts, bson.E{Key: sort.Field, Value: sortValue})
-		}
-		query.Check()
-		total, err := query.Count()
-		if err != nil {
-			ctx.AbortWithError(http.StatusInternalServerError, err)
-		} else if objects, err := query.Select(selector); err != nil {
-			ctx.AbortWithError(http.StatusInternalServerError, err)
-		} else {
-			if objects == nil {
-				objects = []T{}
-			}
-			ctx.JSON(http.StatusOK, &tabulatorResponse{LastPage: int(math.Ceil(float64(total) / float64(pagination.Size))), Data: objects})
-		}
-	}
-}
-
 // Start start server
 // cert: tls cert file path
 // key: tls key file path
@@ -263,13 +199,15 @@ func ReadMessage[T any](s *Server, ctx *gin.Context) (*T, error) {
 }
 
 func (s *Server) ResponseError(ctx *gin.Context, code int, err error) {
+	ctx.Set(codeKey, code)
 	if s.WithBSON {
-		ctx.JSON(http.StatusOK, &messageBaseBSON{Code: code, Error: err.Error()})
+		ctx.JSON(http.StatusOK, &messageBaseBSON{Code: code, Error: err.Error(), RequestID: RequestID(ctx)})
 	} else {
-		ctx.JSON(http.StatusOK, &messageBase{Code: code, Error: err.Error()})
+		ctx.JSON(http.StatusOK, &messageBase{Code: code, Error: err.Error(), RequestID: RequestID(ctx)})
 	}
 }
 func (s *Server) ResponseData(ctx *gin.Context, data any) {
+	ctx.Set(codeKey, 0)
 	if s.WithBSON {
 		ctx.JSON(http.StatusOK, &messageBSON{Code: 0, Data: data})
 	} else {
@@ -278,9 +216,26 @@ func (s *Server) ResponseData(ctx *gin.Context, data any) {
 }
 
 func (s *Server) HandleGet(path string, handler func(ctx *gin.Context)) {
-	s.App.GET(path, handler)
+	s.App.GET(path, s.rateLimit, handler)
 }
 
 func (s *Server) HandlePost(path string, handler func(ctx *gin.Context)) {
-	s.App.POST(path, handler)
+	s.App.POST(path, s.rateLimit, handler)
+}
+
+// HandleAPI 注册生成的 @api 方法, 中间件可通过 LookupAPI 获取 service/method
+// 限流在路由上执行, 位于注册前 App.Use 添加的认证中间件之后
+func (s *Server) HandleAPI(httpMethod, service, method, path string, handler func(ctx *gin.Context), options ...HandleOption) {
+	api := &APIMethod{Service: service, Method: method}
+	for _, option := range options {
+		option(api)
+	}
+	s.apis[httpMethod+" "+path] = api
+	s.calls[service+"."+method] = httpMethod + " " + path
+	s.App.Handle(httpMethod, path, s.rateLimit, handler)
+}
+
+// LookupAPI 返回当前路由对应的 @api 方法, 非 @api 路由返回 nil
+func (s *Server) LookupAPI(ctx *gin.Context) *APIMethod {
+	return s.apis[ctx.Request.Method+" "+ctx.FullPath()]
 }
@@ -0,0 +1,297 @@
+package apigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/net/websocket"
+)
+
+// socketFrame WebSocket 上的帧
+// 调用: {id, method, path, header, data}, data 为 HTTP 请求体
+// 返回: {id, status, data}, data 为 message envelope
+// 推送: {event, data}
+type socketFrame struct {
+	ID     uint64            `json:"id,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Path   string            `json:"path,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	Status int               `json:"status,omitempty"`
+	Event  string            `json:"event,omitempty"`
+	Data   json.RawMessage   `json:"data,omitempty"`
+}
+
+// ErrSocketClosed WebSocket 连接已关闭
+var ErrSocketClosed = errors.New("socket closed")
+
+// MaxSocketCalls 每个连接同时执行的最大调用数, 超出的调用返回 429
+var MaxSocketCalls = 16
+
+// Socket 服务端的 WebSocket 连接
+type Socket struct {
+	server *Server
+	conn   *websocket.Conn
+	mutex  sync.Mutex
+	// Values 连接上保存的数据, 如登录后的用户
+	Values sync.Map
+}
+
+func (socket *Socket) send(frame *socketFrame) error {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+	return websocket.JSON.Send(socket.conn, frame)
+}
+
+// Push 向客户端推送事件
+func (socket *Socket) Push(event string, data any) error {
+	var raw []byte
+	var err error
+	if socket.server.WithBSON {
+		raw, err = bson.MarshalExtJSON(&messageBSON{Data: data}, false, true)
+	} else {
+		raw, err = json.Marshal(&message[any]{Data: data})
+	}
+	if err != nil {
+		return err
+	}
+	return socket.send(&socketFrame{Event: event, Data: raw})
+}
+
+// Close 关闭连接
+func (socket *Socket) Close() error {
+	return socket.conn.Close()
+}
+
+type socketContextKey struct{}
+
+// SocketFromContext 通过 WebSocket 调用时返回所在的连接, HTTP 调用返回 nil
+func SocketFromContext(ctx *gin.Context) *Socket {
+	socket, _ := ctx.Request.Context().Value(socketContextKey{}).(*Socket)
+	return socket
+}
+
+// HandleSocket 在 path 注册 WebSocket 入口, 连接上可调用所有 HandleAPI 注册的方法
+// 每次调用按 HTTP 请求经过全部中间件, 各调用并发执行; 不支持 SSE 流方法
+// 浏览器握手时携带 cookie 且不受 CORS 限制, 只接受同源或 AllowOrigins 中的 Origin
+func (s *Server) HandleSocket(path string) {
+	handler := websocket.Server{
+		Handshake: func(config *websocket.Config, request *http.Request) error {
+			if config.Origin == nil {
+				// 非浏览器客户端
+				return nil
+			}
+			if strings.EqualFold(config.Origin.Host, request.Host) || s.allowOrigin(config.Origin.String()) {
+				return nil
+			}
+			return fmt.Errorf("socket: origin %s not allowed", config.Origin)
+		},
+		Handler: func(conn *websocket.Conn) {
+			socket := &Socket{server: s, conn: conn}
+			s.socketsMutex.Lock()
+			s.sockets[socket] = struct{}{}
+			s.socketsMutex.Unlock()
+			defer func() {
+				s.socketsMutex.Lock()
+				delete(s.sockets, socket)
+				s.socketsMutex.Unlock()
+				conn.Close()
+			}()
+			ctx, cancel := context.WithCancel(context.WithValue(conn.Request().Context(), socketContextKey{}, socket))
+			defer cancel()
+			limit := make(chan struct{}, MaxSocketCalls)
+			for {
+				var frame socketFrame
+				if err := websocket.JSON.Receive(conn, &frame); err != nil {
+					return
+				}
+				select {
+				case limit <- struct{}{}:
+				default:
+					socket.send(&socketFrame{ID: frame.ID, Status: http.StatusTooManyRequests})
+					continue
+				}
+				go func() {
+					defer func() { <-limit }()
+					s.serveSocketCall(ctx, socket, &frame)
+				}()
+			}
+		},
+	}
+	s.App.GET(path, func(ctx *gin.Context) {
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+	})
+}
+
+// serveSocketCall 将调用帧交给对应的 @api 方法处理
+func (s *Server) serveSocketCall(ctx context.Context, socket *Socket, frame *socketFrame) {
+	header := make(http.Header)
+	for key, value := range frame.Header {
+		header.Set(key, value)
+	}
+	reply := &socketFrame{ID: frame.ID}
+	reply.Status, reply.Data = s.dispatch(ctx, frame.Method, frame.Path, header, socket.conn.Request(), frame.Data)
+	// 发送失败说明连接已关闭, 由 Handler 清理
+	socket.send(reply)
+}
+
+// Broadcast 向所有 WebSocket 连接推送事件
+func (s *Server) Broadcast(event string, data any) {
+	s.socketsMutex.Lock()
+	sockets := make([]*Socket, 0, len(s.sockets))
+	for socket := range s.sockets {
+		sockets = append(sockets, socket)
+	}
+	s.socketsMutex.Unlock()
+	for _, socket := range sockets {
+		socket.Push(event, data)
+	}
+}
+
+// PushHandler 处理服务端推送, decode 按 Client.WithBSON 解码推送的数据
+type PushHandler func(event string, decode func(v any) error)
+
+// clientSocket 客户端的 WebSocket 连接
+type clientSocket struct {
+	conn    *websocket.Conn
+	mutex   sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *socketFrame
+	err     error
+}
+
+// DialSocket 连接 path 上的 WebSocket 入口, 之后 Request/Notify 通过该连接发送
+// onPush 可选, 接收服务端推送
+func (c *Client) DialSocket(path string, onPush PushHandler) error {
+	location := c.BuildURL(path)
+	origin := c.host
+	if rest, ok := strings.CutPrefix(location, "http"); ok {
+		location = "ws" + rest
+	}
+	conn, err := websocket.Dial(location, "", origin)
+	if err != nil {
+		return err
+	}
+	socket := &clientSocket{conn: conn, pending: make(map[uint64]chan *socketFrame)}
+	go socket.receive(c, onPush)
+	c.socketMutex.Lock()
+	old := c.socket
+	c.socket = socket
+	c.socketMutex.Unlock()
+	if old != nil {
+		old.conn.Close()
+	}
+	return nil
+}
+
+// CloseSocket 关闭 WebSocket 连接, 之后恢复使用 HTTP 请求
+func (c *Client) CloseSocket() error {
+	c.socketMutex.Lock()
+	socket := c.socket
+	c.socket = nil
+	c.socketMutex.Unlock()
+	if socket == nil {
+		return nil
+	}
+	return socket.conn.Close()
+}
+
+func (c *Client) currentSocket() *clientSocket {
+	c.socketMutex.Lock()
+	defer c.socketMutex.Unlock()
+	return c.socket
+}
+
+func (socket *clientSocket) receive(c *Client, onPush PushHandler) {
+	var err error
+	for {
+		var frame socketFrame
+		if err = websocket.JSON.Receive(socket.conn, &frame); err != nil {
+			break
+		}
+		if frame.ID == 0 {
+			if onPush != nil {
+				data := frame.Data
+				onPush(frame.Event, func(v any) error {
+					if c.WithBSON {
+						var msg message[bson.RawValue]
+						if err := bson.UnmarshalExtJSON(data, false, &msg); err != nil {
+							return err
+						}
+						return msg.Data.Unmarshal(v)
+					}
+					var msg message[json.RawMessage]
+					if err := json.Unmarshal(data, &msg); err != nil {
+						return err
+					}
+					return json.Unmarshal(msg.Data, v)
+				})
+			}
+			continue
+		}
+		socket.mutex.Lock()
+		ch, ok := socket.pending[frame.ID]
+		delete(socket.pending, frame.ID)
+		socket.mutex.Unlock()
+		if ok {
+			ch <- &frame
+		}
+	}
+	socket.mutex.Lock()
+	socket.err = fmt.Errorf("%w: %w", ErrSocketClosed, err)
+	for id, ch := range socket.pending {
+		delete(socket.pending, id)
+		close(ch)
+	}
+	socket.mutex.Unlock()
+}
+
+// call 发送调用帧并等待返回, 返回 envelope
+func (socket *clientSocket) call(ctx context.Context, method, path string, headers http.Header, data []byte) ([]byte, error) {
+	if data != nil && !json.Valid(data) {
+		return nil, fmt.Errorf("socket: request body must be JSON")
+	}
+	ch := make(chan *socketFrame, 1)
+	socket.mutex.Lock()
+	if socket.err != nil {
+		socket.mutex.Unlock()
+		return nil, socket.err
+	}
+	socket.nextID++
+	frame := &socketFrame{ID: socket.nextID, Method: method, Path: path, Data: data, Header: make(map[string]string)}
+	socket.pending[frame.ID] = ch
+	for key := range headers {
+		frame.Header[key] = headers.Get(key)
+	}
+	err := websocket.JSON.Send(socket.conn, frame)
+	socket.mutex.Unlock()
+	if err != nil {
+		socket.mutex.Lock()
+		delete(socket.pending, frame.ID)
+		socket.mutex.Unlock()
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		socket.mutex.Lock()
+		delete(socket.pending, frame.ID)
+		socket.mutex.Unlock()
+		return nil, ctx.Err()
+	case reply, ok := <-ch:
+		if !ok {
+			socket.mutex.Lock()
+			defer socket.mutex.Unlock()
+			return nil, socket.err
+		}
+		if reply.Status != http.StatusOK {
+			return nil, fmt.Errorf("socket: %s %s: status %d", method, path, reply.Status)
+		}
+		return reply.Data, nil
+	}
+}
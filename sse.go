@@ -0,0 +1,422 @@
+package apigo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// LastEventIDHeader 客户端重连时携带的最后一个事件 ID
+	LastEventIDHeader = "Last-Event-ID"
+	// streamRequestParam SSE 请求参数, EventSource 只能使用 GET
+	streamRequestParam = "request"
+	// streamEndEvent 流正常结束, 客户端收到后不再重连
+	streamEndEvent = "end"
+	// streamErrorEvent 流出错, data 为 {code, error}
+	streamErrorEvent = "error"
+)
+
+// ReadStreamRequest 读取 SSE 请求的参数(查询参数 request 中的 JSON)
+func ReadStreamRequest[T any](s *Server, ctx *gin.Context) (*T, error) {
+	var request T
+	data := ctx.Query(streamRequestParam)
+	if data == "" {
+		return &request, nil
+	}
+	var err error
+	if s.WithBSON {
+		err = bson.UnmarshalExtJSON([]byte(data), false, &request)
+	} else {
+		err = json.Unmarshal([]byte(data), &request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// sseWriter 写入 SSE 事件, 按 Last-Event-ID 跳过客户端已收到的事件
+type sseWriter struct {
+	server *Server
+	ctx    *gin.Context
+	id     int64
+	skip   int64
+}
+
+func newSSEWriter(s *Server, ctx *gin.Context) *sseWriter {
+	w := &sseWriter{server: s, ctx: ctx}
+	if last := LastEventID(ctx); last > 0 {
+		w.skip = last
+	}
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Set(codeKey, 0)
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+	return w
+}
+
+func (w *sseWriter) marshal(value any) ([]byte, error) {
+	if w.server.WithBSON {
+		return bson.MarshalExtJSON(value, false, true)
+	}
+	return json.Marshal(value)
+}
+
+func (w *sseWriter) write(event string, id int64, data []byte) error {
+	var builder strings.Builder
+	if id > 0 {
+		fmt.Fprintf(&builder, "id: %d\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&builder, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fmt.Fprintf(&builder, "data: %s\n", line)
+	}
+	builder.WriteString("\n")
+	if _, err := w.ctx.Writer.WriteString(builder.String()); err != nil {
+		return err
+	}
+	w.ctx.Writer.Flush()
+	return w.ctx.Request.Context().Err()
+}
+
+// emit 写入一项, 重连时按序号跳过已发送的项
+// 只有每次调用都产生相同序列的流才能正确续传, 否则生产者应通过 LastEventID 自行续传
+func (w *sseWriter) emit(item any) error {
+	w.id++
+	if w.id <= w.skip {
+		return w.ctx.Request.Context().Err()
+	}
+	data, err := w.marshal(item)
+	if err != nil {
+		return err
+	}
+	return w.write("", w.id, data)
+}
+
+// finish 写入结束或错误事件
+func (w *sseWriter) finish(code int, err error) {
+	if errors.Is(err, context.Canceled) || w.ctx.Request.Context().Err() != nil {
+		// 客户端已断开
+		return
+	}
+	if err != nil {
+		w.ctx.Set(codeKey, code)
+		data, _ := w.marshal(&messageBase{Code: code, Error: err.Error(), RequestID: RequestID(w.ctx)})
+		w.write(streamErrorEvent, 0, data)
+		return
+	}
+	w.write(streamEndEvent, 0, []byte("{}"))
+}
+
+// LastEventID 客户端重连时携带的最后一个事件 ID, 首次连接为 0
+func LastEventID(ctx *gin.Context) int64 {
+	last, _ := strconv.ParseInt(ctx.GetHeader(LastEventIDHeader), 10, 64)
+	return last
+}
+
+// StreamEvents 将 items 作为 SSE 发送, items 关闭后结束
+// 客户端断开后继续读取并丢弃 items 直到关闭, 避免生产者阻塞
+// 生产者无法得知断开, 需要提前结束的流应使用 func(T) error 参数的形式
+func StreamEvents[T any](s *Server, ctx *gin.Context, items <-chan T) {
+	w := newSSEWriter(s, ctx)
+	done := ctx.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			go Drain(items)
+			return
+		case item, ok := <-items:
+			if !ok {
+				w.finish(0, nil)
+				return
+			}
+			if err := w.emit(item); err != nil {
+				w.finish(http.StatusInternalServerError, err)
+				go Drain(items)
+				return
+			}
+		}
+	}
+}
+
+// Drain 读取并丢弃 items 直到关闭, 消费者提前结束时使用, 避免生产者阻塞
+func Drain[T any](items <-chan T) {
+	for range items {
+	}
+}
+
+// StreamEmitter 调用 run, run 中每次 emit 发送一个事件, emit 在客户端断开后返回错误
+func StreamEmitter[T any](s *Server, ctx *gin.Context, run func(emit func(T) error) error) {
+	w := newSSEWriter(s, ctx)
+	err := run(func(item T) error {
+		return w.emit(item)
+	})
+	w.finish(501, err)
+}
+
+// Stream SSE 流的客户端迭代器, 断线后携带 Last-Event-ID 重连
+//
+//	stream, err := apigo.OpenStream[Event](client, path, request)
+//	defer stream.Close()
+//	for stream.Next() {
+//		event := stream.Value()
+//	}
+//	err = stream.Err()
+type Stream[T any] struct {
+	client  *Client
+	path    string
+	url     string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	lastID  string
+	retry   time.Duration
+	retries int
+	value   T
+	err     error
+	done    bool
+}
+
+// StreamRetries 连接断开后的最大连续重连次数
+var StreamRetries = 5
+
+// OpenStream 打开 SSE 流, request 编码为查询参数
+func OpenStream[T any](c *Client, path string, request any) (*Stream[T], error) {
+	return OpenStreamContext[T](context.Background(), c, path, request)
+}
+
+// OpenStreamContext 同 OpenStream, ctx 取消时关闭流, 其中的 span 作为连接 span 的父 span
+func OpenStreamContext[T any](ctx context.Context, c *Client, path string, request any) (*Stream[T], error) {
+	u, err := url.Parse(c.BuildURL(path))
+	if err != nil {
+		return nil, err
+	}
+	if request != nil {
+		var data []byte
+		if c.WithBSON {
+			data, err = bson.MarshalExtJSON(request, false, true)
+		} else {
+			data, err = json.Marshal(request)
+		}
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Set(streamRequestParam, string(data))
+		u.RawQuery = query.Encode()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &Stream[T]{client: c, path: path, url: u.String(), ctx: ctx, cancel: cancel, retry: time.Second}
+	if err = stream.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// connect 建立连接, 每次连接(包括重连)记录一次指标和 span
+func (stream *Stream[T]) connect() (err error) {
+	c := stream.client
+	var code int
+	if c.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			c.Metrics.ObserveRequest(stream.path, http.MethodGet, code, err, time.Since(start))
+		}()
+	}
+	request, err := http.NewRequestWithContext(stream.ctx, http.MethodGet, stream.url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	request.Header.Set(RequestIDHeader, outgoingRequestID(stream.ctx))
+	if stream.lastID != "" {
+		request.Header.Set(LastEventIDHeader, stream.lastID)
+	}
+	if span := c.traceRequest(stream.ctx, stream.path, http.MethodGet, request.Header); span != nil {
+		defer func() {
+			span.SetAttribute("apigo.code", code)
+			span.SetError(err)
+			span.Finish()
+		}()
+	}
+	client := c.StreamClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return fmt.Errorf("stream: status %d", response.StatusCode)
+	}
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream") {
+		// 参数错误等情况服务端返回 envelope
+		defer response.Body.Close()
+		var msg messageBase
+		data, _ := io.ReadAll(response.Body)
+		if json.Unmarshal(data, &msg) == nil && msg.Code != 0 {
+			code = msg.Code
+			return errors.New(msg.Error)
+		}
+		return fmt.Errorf("stream: unexpected content type %q", response.Header.Get("Content-Type"))
+	}
+	stream.body = response.Body
+	stream.reader = bufio.NewReader(response.Body)
+	return nil
+}
+
+// readEvent 读取一个事件
+func (stream *Stream[T]) readEvent() (id, event, data string, err error) {
+	var lines []string
+	for {
+		line, err := stream.reader.ReadString('\n')
+		if err != nil {
+			return "", "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if lines == nil && id == "" && event == "" {
+				continue
+			}
+			return id, event, strings.Join(lines, "\n"), nil
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			lines = append(lines, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				stream.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (stream *Stream[T]) unmarshal(data string, value any) error {
+	if stream.client.WithBSON {
+		return bson.UnmarshalExtJSON([]byte(data), false, value)
+	}
+	return json.Unmarshal([]byte(data), value)
+}
+
+// Next 读取下一项, 流结束或出错时返回 false
+func (stream *Stream[T]) Next() bool {
+	for !stream.done {
+		id, event, data, err := stream.readEvent()
+		if err != nil {
+			if !stream.reconnect(err) {
+				return false
+			}
+			continue
+		}
+		stream.retries = 0
+		switch event {
+		case streamEndEvent:
+			stream.Close()
+			return false
+		case streamErrorEvent:
+			var msg messageBase
+			if err := stream.unmarshal(data, &msg); err != nil {
+				stream.fail(err)
+			} else {
+				stream.fail(errors.New(msg.Error))
+			}
+			return false
+		case "", "message":
+			var value T
+			if err := stream.unmarshal(data, &value); err != nil {
+				stream.fail(err)
+				return false
+			}
+			if id != "" {
+				stream.lastID = id
+			}
+			stream.value = value
+			return true
+		}
+	}
+	return false
+}
+
+// streamMaxRetryDelay 重连间隔的上限
+const streamMaxRetryDelay = 30 * time.Second
+
+// reconnect 断开后按 retry 间隔重连, 重连失败也计入 StreamRetries, 间隔逐次加倍
+func (stream *Stream[T]) reconnect(err error) bool {
+	stream.body.Close()
+	delay := stream.retry
+	for {
+		if stream.ctx.Err() != nil {
+			stream.done = true
+			return false
+		}
+		if stream.retries >= StreamRetries {
+			stream.fail(err)
+			return false
+		}
+		stream.retries++
+		select {
+		case <-stream.ctx.Done():
+			stream.done = true
+			return false
+		case <-time.After(delay):
+		}
+		if err = stream.connect(); err == nil {
+			return true
+		}
+		if delay *= 2; delay > streamMaxRetryDelay {
+			delay = streamMaxRetryDelay
+		}
+	}
+}
+
+func (stream *Stream[T]) fail(err error) {
+	stream.err = err
+	stream.Close()
+}
+
+// Value 当前项
+func (stream *Stream[T]) Value() T {
+	return stream.value
+}
+
+// Err 流出错时返回错误, 正常结束为 nil
+func (stream *Stream[T]) Err() error {
+	return stream.err
+}
+
+// Close 关闭流
+func (stream *Stream[T]) Close() error {
+	stream.done = true
+	stream.cancel()
+	if stream.body != nil {
+		return stream.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package apigo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamReadEvent(t *testing.T) {
+	type event struct {
+		ID, Event, Data string
+	}
+	for _, test := range []struct {
+		name  string
+		input string
+		want  []event
+		retry time.Duration
+	}{
+		{name: "data", input: "data: {\"a\":1}\n\n", want: []event{{Data: `{"a":1}`}}},
+		{name: "id and event", input: "id: 3\nevent: end\ndata: {}\n\n", want: []event{{ID: "3", Event: "end", Data: "{}"}}},
+		{name: "multiline", input: "data: a\ndata: b\n\n", want: []event{{Data: "a\nb"}}},
+		{name: "no space", input: "id:7\ndata:x\n\n", want: []event{{ID: "7", Data: "x"}}},
+		{name: "crlf", input: "id: 1\r\ndata: x\r\n\r\n", want: []event{{ID: "1", Data: "x"}}},
+		{name: "comments and blank lines", input: "\n: ping\n\ndata: x\n\n", want: []event{{Data: "x"}}},
+		{name: "retry", input: "retry: 250\n\ndata: x\n\n", want: []event{{Data: "x"}}, retry: 250 * time.Millisecond},
+		{name: "several", input: "id: 1\ndata: a\n\nid: 2\ndata: b\n\n", want: []event{{ID: "1", Data: "a"}, {ID: "2", Data: "b"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stream := &Stream[any]{reader: bufio.NewReader(strings.NewReader(test.input)), retry: time.Second}
+			var got []event
+			for {
+				id, name, data, err := stream.readEvent()
+				if err != nil {
+					break
+				}
+				got = append(got, event{ID: id, Event: name, Data: data})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("events %+v, want %+v", got, test.want)
+			}
+			if test.retry > 0 && stream.retry != test.retry {
+				t.Fatalf("retry %v, want %v", stream.retry, test.retry)
+			}
+		})
+	}
+}
+
+func TestStreamLastEventID(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.WithBSON = false
+	s.App.GET("/events", func(ctx *gin.Context) {
+		StreamEmitter(s, ctx, func(emit func(int) error) error {
+			for i := 1; i <= 4; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	for _, test := range []struct {
+		name string
+		last string
+		want string
+	}{
+		{name: "first", want: "id: 1\ndata: 1\n\nid: 2\ndata: 2\n\nid: 3\ndata: 3\n\nid: 4\ndata: 4\n\nevent: end\ndata: {}\n\n"},
+		{name: "resume", last: "2", want: "id: 3\ndata: 3\n\nid: 4\ndata: 4\n\nevent: end\ndata: {}\n\n"},
+		{name: "all received", last: "4", want: "event: end\ndata: {}\n\n"},
+		{name: "invalid", last: "x", want: "id: 1\ndata: 1\n\nid: 2\ndata: 2\n\nid: 3\ndata: 3\n\nid: 4\ndata: 4\n\nevent: end\ndata: {}\n\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if test.last != "" {
+				request.Header.Set(LastEventIDHeader, test.last)
+			}
+			recorder := httptest.NewRecorder()
+			s.App.ServeHTTP(recorder, request)
+			if got := recorder.Body.String(); got != test.want {
+				t.Fatalf("body %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStreamReconnect(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch connections.Add(1) {
+		case 1:
+			// 发送两项后断开
+			fmt.Fprint(w, "retry: 1\n\nid: 1\ndata: 1\n\nid: 2\ndata: 2\n\n")
+		case 2:
+			// 重连失败也计入重试
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			if last := r.Header.Get(LastEventIDHeader); last != "2" {
+				t.Errorf("Last-Event-ID %q, want 2", last)
+			}
+			fmt.Fprint(w, "id: 3\ndata: 3\n\nevent: end\ndata: {}\n\n")
+		}
+	}))
+	defer server.Close()
+	client := &Client{host: server.URL, StreamClient: server.Client()}
+	stream, err := OpenStreamContext[int](context.Background(), client, "/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	var got []int
+	for stream.Next() {
+		got = append(got, stream.Value())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) || connections.Load() != 3 {
+		t.Fatalf("values %v after %d connections", got, connections.Load())
+	}
+}
+
+func TestStreamRetriesExhausted(t *testing.T) {
+	retries := StreamRetries
+	StreamRetries = 3
+	defer func() { StreamRetries = retries }()
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 1\n\nid: 1\ndata: 1\n\n")
+	}))
+	defer server.Close()
+	client := &Client{host: server.URL, StreamClient: server.Client()}
+	stream, err := OpenStreamContext[int](context.Background(), client, "/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for stream.Next() {
+	}
+	if stream.Err() == nil {
+		t.Fatal("want error after retries")
+	}
+	if n := connections.Load(); n != int32(1+StreamRetries) {
+		t.Fatalf("%d connections, want %d", n, 1+StreamRetries)
+	}
+}
@@ -0,0 +1,53 @@
+package apigo
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TabulatorRequest Tabulator 远程分页请求
+type TabulatorRequest struct {
+	Page    int           `json:"page" bson:"page"`                         // page - the page number being requested
+	Size    int           `json:"size" bson:"size"`                         // size - the number of rows to a page (if paginationSize is set)
+	Sorters []QuerySort   `json:"sort" bson:"sort"`                         // sorters - the first current sorters(if any)
+	Filter  []QueryFilter `json:"filter" bson:"filter"`                     // filter - an array of the current filters (if any)
+	Cursor  string        `json:"cursor,omitempty" bson:"cursor,omitempty"` // cursor - next_cursor of the previous page (WithCursor)
+}
+type tabulatorResponse struct {
+	LastPage   int    `bson:"last_page" json:"last_page"`
+	Data       any    `bson:"data" json:"data"`
+	NextCursor string `bson:"next_cursor,omitempty" json:"next_cursor,omitempty"`
+}
+
+// MarshalJSON 格式化
+func (response *tabulatorResponse) MarshalJSON() ([]byte, error) {
+	return bson.MarshalExtJSON(response, false, true)
+}
+
+// UnmarshalJSON 读取
+func (response *tabulatorResponse) UnmarshalJSON(data []byte) error {
+	return bson.UnmarshalExtJSON(data, false, response)
+}
+
+// TabulatorAdapter Tabulator 远程分页/排序/过滤协议
+type TabulatorAdapter struct{}
+
+func (TabulatorAdapter) Parse(ctx *gin.Context) (*QueryRequest, error) {
+	var pagination TabulatorRequest
+	if err := ctx.ShouldBindJSON(&pagination); err != nil {
+		return nil, err
+	}
+	return &QueryRequest{Page: pagination.Page, Size: pagination.Size, Cursor: pagination.Cursor, Sorters: pagination.Sorters, Filter: pagination.Filter}, nil
+}
+
+func (TabulatorAdapter) Write(ctx *gin.Context, request *QueryRequest, result *QueryResult) {
+	ctx.JSON(http.StatusOK, &tabulatorResponse{LastPage: result.LastPage, Data: result.Data, NextCursor: result.NextCursor})
+}
+
+// TabulatorQuery Tabulator 远程分页/排序/过滤
+// options: WithQueryFields, WithMaxPageSize, WithCursor, WithoutCount, WithEstimatedCount, WithDatabase, WithRegexFilters
+func TabulatorQuery[T any](ctx *gin.Context, collection string, selector any, options ...QueryOption) {
+	Query[T](ctx, TabulatorAdapter{}, collection, selector, options...)
+}
@@ -0,0 +1,294 @@
+package apigo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceparentHeader W3C Trace Context 请求头
+const TraceparentHeader = "traceparent"
+
+// SpanKind span 类型
+type SpanKind string
+
+const (
+	SpanKindServer SpanKind = "server"
+	SpanKindClient SpanKind = "client"
+)
+
+// SpanContext W3C traceparent 中携带的信息
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid trace-id 与 span-id 均不为全 0
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent 格式化为 traceparent 头
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+var errTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent 解析 traceparent 头
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errTraceparent
+	}
+	// version 00 只允许 4 段, 更高版本可能追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errTraceparent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errTraceparent
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return sc, errTraceparent
+	}
+	return sc, nil
+}
+
+// Span 一次调用的追踪记录
+type Span struct {
+	Name       string         `json:"name"`
+	Kind       SpanKind       `json:"kind"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+
+	context SpanContext
+	tracer  *Tracer
+	mu      sync.Mutex
+	ended   bool
+}
+
+// Context 返回 span 的 SpanContext
+func (span *Span) Context() SpanContext {
+	return span.context
+}
+
+// SetAttribute 设置属性
+func (span *Span) SetAttribute(key string, value any) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	if span.Attributes == nil {
+		span.Attributes = make(map[string]any)
+	}
+	span.Attributes[key] = value
+}
+
+// SetError 记录错误
+func (span *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.Error = err.Error()
+}
+
+// Finish 结束 span 并交给 exporter, 重复调用无效
+func (span *Span) Finish() {
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.End = time.Now()
+	span.mu.Unlock()
+	if span.tracer != nil && span.tracer.Exporter != nil && span.context.Sampled {
+		span.tracer.Exporter.ExportSpan(span)
+	}
+}
+
+// SpanExporter 接收结束的 span
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// StdoutExporter 以 JSON 行输出 span
+type StdoutExporter struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+// NewStdoutExporter 创建输出到 w 的 exporter
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{Writer: w}
+}
+
+func (exporter *StdoutExporter) ExportSpan(span *Span) {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.Writer.Write(append(data, '\n'))
+}
+
+// InMemoryExporter 在内存中记录 span, 用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (exporter *InMemoryExporter) ExportSpan(span *Span) {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.spans = append(exporter.spans, span)
+}
+
+// Spans 返回已记录的 span
+func (exporter *InMemoryExporter) Spans() []*Span {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	spans := make([]*Span, len(exporter.spans))
+	copy(spans, exporter.spans)
+	return spans
+}
+
+// Reset 清空已记录的 span
+func (exporter *InMemoryExporter) Reset() {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.spans = nil
+}
+
+// Tracer 创建 span
+type Tracer struct {
+	Exporter SpanExporter
+}
+
+// NewTracer 创建使用 exporter 的 Tracer
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{Exporter: exporter}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan 将 span 附加到 context
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext 读取 context 中的 span
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// Start 创建 span, ctx 中已有 span 时作为其子 span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.context
+	}
+	return t.start(ctx, name, kind, parent)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), tracer: t}
+	if parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.ParentID = hex.EncodeToString(parent.SpanID[:])
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanID[:])
+	span.TraceID = hex.EncodeToString(span.context.TraceID[:])
+	span.SpanID = hex.EncodeToString(span.context.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// trace 从 traceparent 继续追踪, span 名称为 @api 的 service.method
+func (s *Server) trace(ctx *gin.Context) {
+	if s.Tracer == nil {
+		ctx.Next()
+		return
+	}
+	name := ctx.Request.Method + " " + ctx.FullPath()
+	if api := s.LookupAPI(ctx); api != nil {
+		name = api.Service + "." + api.Method
+	}
+	parent, _ := ParseTraceparent(ctx.GetHeader(TraceparentHeader))
+	rctx, span := s.Tracer.start(ctx.Request.Context(), name, SpanKindServer, parent)
+	ctx.Request = ctx.Request.WithContext(rctx)
+	span.SetAttribute("http.method", ctx.Request.Method)
+	span.SetAttribute("http.route", ctx.FullPath())
+	span.SetAttribute("request_id", RequestID(ctx))
+	defer span.Finish()
+	ctx.Next()
+	span.SetAttribute("http.status_code", ctx.Writer.Status())
+	if code, ok := ctx.Get(codeKey); ok {
+		span.SetAttribute("apigo.code", code)
+	}
+	if len(ctx.Errors) > 0 {
+		span.SetError(ctx.Errors.Last())
+	}
+}
+
+// traceRequest 为客户端请求创建 span 并写入 traceparent, ctx 中已有 span 时作为其子 span
+func (c *Client) traceRequest(ctx context.Context, path, method string, headers http.Header) *Span {
+	if c.Tracer == nil {
+		return nil
+	}
+	_, span := c.Tracer.Start(ctx, clientSpanName(path), SpanKindClient)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", c.BuildURL(path))
+	headers.Set(TraceparentHeader, span.context.Traceparent())
+	return span
+}
+
+// clientSpanName 生成的客户端路径以 /Service/Method 结尾, span 名称与服务端一致为 Service.Method
+func clientSpanName(path string) string {
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return path
+	}
+	return parts[len(parts)-2] + "." + parts[len(parts)-1]
+}
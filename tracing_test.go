@@ -0,0 +1,165 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const spanID = "00f067aa0ba902b7"
+	for _, test := range []struct {
+		name    string
+		value   string
+		sampled bool
+		err     bool
+	}{
+		{name: "sampled", value: "00-" + traceID + "-" + spanID + "-01", sampled: true},
+		{name: "not sampled", value: "00-" + traceID + "-" + spanID + "-00"},
+		{name: "future version", value: "01-" + traceID + "-" + spanID + "-01-extra", sampled: true},
+		{name: "extra field in version 00", value: "00-" + traceID + "-" + spanID + "-01-extra", err: true},
+		{name: "version ff", value: "ff-" + traceID + "-" + spanID + "-01", err: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-" + spanID + "-01", err: true},
+		{name: "zero span id", value: "00-" + traceID + "-0000000000000000-01", err: true},
+		{name: "short trace id", value: "00-4bf92f35-" + spanID + "-01", err: true},
+		{name: "not hex", value: "00-" + traceID + "-zzf067aa0ba902b7-01", err: true},
+		{name: "empty", value: "", err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("want error, got %+v", sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.Sampled != test.sampled {
+				t.Fatalf("sampled %v, want %v", sc.Sampled, test.sampled)
+			}
+			// 格式化后总是 version 00
+			if want := "00-" + traceID + "-" + spanID + "-" + map[bool]string{true: "01", false: "00"}[test.sampled]; sc.Traceparent() != want {
+				t.Fatalf("traceparent %s, want %s", sc.Traceparent(), want)
+			}
+		})
+	}
+}
+
+func TestTracerStart(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := NewTracer(exporter)
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindClient)
+	if child.TraceID != root.TraceID || child.ParentID != root.SpanID || child.SpanID == root.SpanID {
+		t.Fatalf("child %+v of root %+v", child, root)
+	}
+	if root.ParentID != "" || SpanFromContext(ctx) != root {
+		t.Fatalf("root %+v", root)
+	}
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	child.Finish()
+	root.Finish()
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0] != child || spans[1] != root || spans[0].Error != "failed" {
+		t.Fatalf("exported %+v", spans)
+	}
+	exporter.Reset()
+	if len(exporter.Spans()) != 0 {
+		t.Fatal("spans after reset")
+	}
+}
+
+func TestServerTrace(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	s := NewServer()
+	defer s.Close()
+	s.WithBSON = false
+	s.Tracer = NewTracer(exporter)
+	var inner *Span
+	s.HandleAPI(http.MethodGet, "User", "Get", "/api/User/Get", func(ctx *gin.Context) {
+		inner = SpanFromContext(ctx.Request.Context())
+		s.ResponseData(ctx, nil)
+	})
+	s.App.GET("/plain", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	for _, test := range []struct {
+		name        string
+		path        string
+		traceparent string
+		want        string
+		exported    bool
+	}{
+		{name: "continue trace", path: "/api/User/Get", traceparent: parent, want: "User.Get", exported: true},
+		{name: "new trace", path: "/api/User/Get", want: "User.Get", exported: true},
+		{name: "invalid traceparent", path: "/api/User/Get", traceparent: "00-xyz", want: "User.Get", exported: true},
+		{name: "route without api", path: "/plain", want: "GET /plain", exported: true},
+		{name: "not sampled", path: "/api/User/Get", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exporter.Reset()
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.traceparent != "" {
+				request.Header.Set(TraceparentHeader, test.traceparent)
+			}
+			s.App.ServeHTTP(httptest.NewRecorder(), request)
+			spans := exporter.Spans()
+			if !test.exported {
+				if len(spans) != 0 {
+					t.Fatalf("exported %+v, want none", spans)
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("exported %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != test.want || span.Kind != SpanKindServer {
+				t.Fatalf("span %s %s, want %s", span.Kind, span.Name, test.want)
+			}
+			if test.path == "/api/User/Get" && inner != span {
+				t.Fatal("handler context does not carry the server span")
+			}
+			if test.traceparent == parent {
+				if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentID != "00f067aa0ba902b7" {
+					t.Fatalf("span %s/%s, want parent from traceparent", span.TraceID, span.ParentID)
+				}
+			} else if span.ParentID != "" {
+				t.Fatalf("parent %s, want new trace", span.ParentID)
+			}
+			if span.Attributes["request_id"] == "" || span.Attributes["http.status_code"] == nil {
+				t.Fatalf("attributes %v", span.Attributes)
+			}
+		})
+	}
+}
+
+func TestClientTraceRequest(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	client := &Client{host: "http://example.com", Tracer: NewTracer(exporter)}
+	ctx, parent := client.Tracer.Start(context.Background(), "User.Get", SpanKindServer)
+	headers := http.Header{}
+	span := client.traceRequest(ctx, "/api/Order/List?page=2", http.MethodPost, headers)
+	if span.Name != "Order.List" || span.Kind != SpanKindClient {
+		t.Fatalf("span %s %s", span.Kind, span.Name)
+	}
+	if span.TraceID != parent.TraceID || span.ParentID != parent.SpanID {
+		t.Fatalf("span %+v, want child of %+v", span, parent)
+	}
+	sc, err := ParseTraceparent(headers.Get(TraceparentHeader))
+	if err != nil || sc != span.Context() {
+		t.Fatalf("traceparent %q: %v", headers.Get(TraceparentHeader), err)
+	}
+	if (&Client{}).traceRequest(ctx, "/api/Order/List", http.MethodPost, http.Header{}) != nil {
+		t.Fatal("span without tracer")
+	}
+}
@@ -0,0 +1,719 @@
+package apigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tus/tusd/pkg/filestore"
+	tusd "github.com/tus/tusd/pkg/handler"
+	"github.com/tus/tusd/pkg/memorylocker"
+)
+
+// TusdHandle 处理一个上传完成的文件
+// ctx: 每个文件独立的请求副本, ctx.Request.Context() 带有单文件超时
+// extra: 请求中的 tag
+type TusdHandle func(ctx *gin.Context, reader io.Reader, info *tusd.FileInfo, extra any) (any, error)
+
+// TusdHandleOption TusdHandle 选项
+type TusdHandleOption func(options *tusdHandleOptions)
+
+type tusdHandleOptions struct {
+	concurrency    int
+	timeout        time.Duration
+	deleteConsumed bool
+}
+
+// WithTusdConcurrency 同时处理的文件数量, 默认 4
+func WithTusdConcurrency(n int) TusdHandleOption {
+	return func(options *tusdHandleOptions) {
+		options.concurrency = n
+	}
+}
+
+// WithTusdTimeout 单个文件的处理超时, 默认不限制
+func WithTusdTimeout(timeout time.Duration) TusdHandleOption {
+	return func(options *tusdHandleOptions) {
+		options.timeout = timeout
+	}
+}
+
+// TusdUploadOption TusdUpload 选项
+type TusdUploadOption func(policy *tusdPolicy)
+
+// WithTusdMaxSize 单个上传的最大字节数
+func WithTusdMaxSize(size int64) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.maxSize = size
+	}
+}
+
+// WithTusdAllowedTypes 允许的 MIME 类型(Upload-Metadata 中的 filetype/type), 支持 "image/*"
+func WithTusdAllowedTypes(types ...string) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		for _, typ := range types {
+			policy.types = append(policy.types, strings.ToLower(typ))
+		}
+	}
+}
+
+// WithTusdAllowedExtensions 允许的扩展名(Upload-Metadata 中的 filename/name), 如 ".png"
+func WithTusdAllowedExtensions(exts ...string) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		for _, ext := range exts {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			policy.exts = append(policy.exts, ext)
+		}
+	}
+}
+
+// WithTusdRequiredMetadata Upload-Metadata 中必须存在的 key
+func WithTusdRequiredMetadata(keys ...string) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.required = append(policy.required, keys...)
+	}
+}
+
+// WithTusdQuota 每个调用方(TusdPrincipal, 未认证时为 IP)未完成上传的总字节数, 进程内统计
+// 上传完成、终止或创建失败时释放
+func WithTusdQuota(bytes int64) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.quota = bytes
+	}
+}
+
+var (
+	errTusdMissingMetadata = errors.New("missing upload metadata")
+	errTusdType            = errors.New("file type is not allowed")
+	errTusdExtension       = errors.New("file extension is not allowed")
+	errTusdQuota           = errors.New("upload quota exceeded")
+	errTusdDeferredLength  = errors.New("upload length is required")
+)
+
+type tusdPolicy struct {
+	maxSize  int64
+	types    []string
+	exts     []string
+	required []string
+	quota    int64
+	// expiration 未完成上传的过期时间
+	expiration  time.Duration
+	locker      TusdStore
+	middlewares []gin.HandlerFunc
+
+	mu    sync.Mutex
+	usage map[string]int64
+	// pending 已通过检查但尚未创建的上传, key 为请求的 tusdReservationHeader
+	pending map[string]tusdReservation
+	uploads map[string]tusdReservation
+}
+
+type tusdReservation struct {
+	owner string
+	size  int64
+}
+
+func metadataValue(meta tusd.MetaData, keys ...string) string {
+	for _, key := range keys {
+		if value := meta[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func tusdOwner(event tusd.HookEvent) string {
+	if principal := TusdPrincipal(event); principal != "" {
+		return principal
+	}
+	return event.HTTPRequest.Header.Get(tusdClientIPHeader)
+}
+
+// check 在接收数据前检查上传
+func (policy *tusdPolicy) check(event tusd.HookEvent) error {
+	meta := event.Upload.MetaData
+	for _, key := range policy.required {
+		if meta[key] == "" {
+			return tusd.NewHTTPError(fmt.Errorf("%w: %s", errTusdMissingMetadata, key), http.StatusBadRequest)
+		}
+	}
+	if len(policy.types) > 0 {
+		typ := strings.ToLower(metadataValue(meta, "filetype", "type"))
+		if typ, _, _ = strings.Cut(typ, ";"); !matchMIME(policy.types, strings.TrimSpace(typ)) {
+			return tusd.NewHTTPError(errTusdType, http.StatusUnsupportedMediaType)
+		}
+	}
+	if len(policy.exts) > 0 {
+		ext := strings.ToLower(filepath.Ext(metadataValue(meta, "filename", "name")))
+		if !slices.Contains(policy.exts, ext) {
+			return tusd.NewHTTPError(errTusdExtension, http.StatusUnsupportedMediaType)
+		}
+	}
+	if policy.quota > 0 && event.Upload.SizeIsDeferred {
+		return tusd.NewHTTPError(errTusdDeferredLength, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// take 检查并占用调用方配额, 创建成功后在 reserve 中与上传 ID 关联
+func (policy *tusdPolicy) take(event tusd.HookEvent) error {
+	if policy.quota <= 0 {
+		return nil
+	}
+	owner := tusdOwner(event)
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if policy.usage[owner]+event.Upload.Size > policy.quota {
+		return tusd.NewHTTPError(errTusdQuota, http.StatusRequestEntityTooLarge)
+	}
+	policy.usage[owner] += event.Upload.Size
+	policy.pending[event.HTTPRequest.Header.Get(tusdReservationHeader)] = tusdReservation{owner: owner, size: event.Upload.Size}
+	return nil
+}
+
+// reserve 将创建请求的占用关联到上传 ID, 用于完成或终止时释放
+func (policy *tusdPolicy) reserve(event tusd.HookEvent) {
+	if policy.quota <= 0 {
+		return
+	}
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	token := event.HTTPRequest.Header.Get(tusdReservationHeader)
+	if reservation, ok := policy.pending[token]; ok {
+		delete(policy.pending, token)
+		policy.uploads[event.Upload.ID] = reservation
+	}
+}
+
+// cancel 释放创建失败的请求的占用
+func (policy *tusdPolicy) cancel(token string) {
+	if policy.quota <= 0 {
+		return
+	}
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if reservation, ok := policy.pending[token]; ok {
+		delete(policy.pending, token)
+		policy.free(reservation)
+	}
+}
+
+// release 释放上传的占用
+func (policy *tusdPolicy) release(id string) {
+	if policy.quota <= 0 {
+		return
+	}
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if reservation, ok := policy.uploads[id]; ok {
+		delete(policy.uploads, id)
+		policy.free(reservation)
+	}
+}
+
+func (policy *tusdPolicy) free(reservation tusdReservation) {
+	if policy.usage[reservation.owner] -= reservation.size; policy.usage[reservation.owner] <= 0 {
+		delete(policy.usage, reservation.owner)
+	}
+}
+
+func matchMIME(patterns []string, typ string) bool {
+	for _, pattern := range patterns {
+		if pattern == typ {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(typ, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// TusdStore 可加入 tusd.StoreComposer 的存储或锁,
+// 如 filestore.FileStore, NewS3Store, GridFSStore, memorylocker.MemoryLocker, filelocker.FileLocker
+type TusdStore interface {
+	UseIn(composer *tusd.StoreComposer)
+}
+
+// WithTusdLocker 设置上传锁, 默认使用 memorylocker; 多进程共享 filestore 目录时使用 filelocker
+func WithTusdLocker(locker TusdStore) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.locker = locker
+	}
+}
+
+func tusdListerOf(store TusdStore) TusdLister {
+	switch store := store.(type) {
+	case TusdLister:
+		return store
+	case filestore.FileStore:
+		return FileStoreLister{Path: store.Path}
+	case *filestore.FileStore:
+		return FileStoreLister{Path: store.Path}
+	}
+	return nil
+}
+
+// tus 协议使用的请求头, 由 Server 的 CORS 配置统一处理
+var (
+	tusdAllowHeaders  = []string{"X-Requested-With", "X-HTTP-Method-Override", "Upload-Length", "Upload-Offset", "Tus-Resumable", "Upload-Metadata", "Upload-Defer-Length", "Upload-Concat"}
+	tusdExposeHeaders = []string{"Upload-Offset", "Location", "Upload-Length", "Tus-Version", "Tus-Resumable", "Tus-Max-Size", "Tus-Extension", "Upload-Metadata", "Upload-Defer-Length", "Upload-Concat", "Upload-Expires"}
+)
+
+// TusdEndpoint 一个独立的 tus 上传入口, 拥有自己的存储、限制、回调和 TusdHandle
+type TusdEndpoint struct {
+	server   *Server
+	basePath string
+	composer *tusd.StoreComposer
+	policy   *tusdPolicy
+	hooks    tusdHooks
+	janitor  *tusdJanitor
+	// stop 关闭后停止事件分发
+	stop chan struct{}
+	once sync.Once
+}
+
+// WithTusdMiddleware 只作用于该上传入口的中间件, 如认证(SetPrincipal)
+func WithTusdMiddleware(handlers ...gin.HandlerFunc) TusdUploadOption {
+	return func(policy *tusdPolicy) {
+		policy.middlewares = append(policy.middlewares, handlers...)
+	}
+}
+
+// TusdUpload handle upload request
+// store: upload file store path
+// path: upload request path. eg: /upload/
+func (s *Server) TusdUpload(store, path string, options ...TusdUploadOption) (*TusdEndpoint, error) {
+	return s.TusdUploadStore(filestore.New(store), path, options...)
+}
+
+// TusdUploadStore 使用任意 tusd 存储创建上传入口, 只处理 path 下的请求
+// store: 如 filestore.New(dir), NewS3Store(config), NewGridFSStore(database, "uploads", filestore.New(dir))
+// path: upload request path. eg: /upload/
+func (s *Server) TusdUploadStore(store TusdStore, path string, options ...TusdUploadOption) (*TusdEndpoint, error) {
+	policy := &tusdPolicy{usage: make(map[string]int64), pending: make(map[string]tusdReservation), uploads: make(map[string]tusdReservation)}
+	for _, option := range options {
+		option(policy)
+	}
+	composer := tusd.NewStoreComposer()
+	store.UseIn(composer)
+	if policy.locker != nil {
+		policy.locker.UseIn(composer)
+	} else if !composer.UsesLocker {
+		memorylocker.New().UseIn(composer)
+	}
+	// 根路径时为 "/"
+	prefix := strings.TrimSuffix("/"+strings.Trim(path, "/"), "/")
+	basePath := prefix + "/"
+	endpoint := &TusdEndpoint{server: s, basePath: basePath, composer: composer, policy: policy, stop: make(chan struct{})}
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:                basePath,
+		StoreComposer:           composer,
+		MaxSize:                 policy.maxSize,
+		DisableCors:             true,
+		NotifyCreatedUploads:    true,
+		NotifyUploadProgress:    true,
+		NotifyCompleteUploads:   true,
+		NotifyTerminatedUploads: true,
+		PreUploadCreateCallback: func(event tusd.HookEvent) error {
+			if err := policy.check(event); err != nil {
+				return err
+			}
+			if err := endpoint.hooks.preCreateCallback(event); err != nil {
+				return err
+			}
+			return policy.take(event)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	go endpoint.hooks.listen(endpoint.stop, handler.UploadProgress, &endpoint.hooks.progress)
+	go endpoint.listenUploads(handler)
+	if lister := tusdListerOf(store); policy.expiration > 0 && lister != nil {
+		endpoint.janitor = &tusdJanitor{
+			composer: composer,
+			lister:   lister,
+			policy:   policy,
+			ttl:      policy.expiration,
+			stop:     make(chan struct{}),
+		}
+		go endpoint.janitor.run()
+	}
+	stripHandle := http.StripPrefix(basePath, handler)
+	serve := func(ctx *gin.Context) {
+		select {
+		case <-endpoint.stop:
+			// 事件不再分发, tusd 发送事件会阻塞
+			ctx.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		default:
+		}
+		if ctx.Request.URL.Path+"/" == basePath {
+			ctx.Request.URL.Path = basePath
+		}
+		ctx.Request.Header.Del(tusdPrincipalHeader)
+		if principal := Principal(ctx); principal != "" {
+			ctx.Request.Header.Set(tusdPrincipalHeader, principal)
+		}
+		ctx.Request.Header.Set(tusdClientIPHeader, ctx.ClientIP())
+		token := NewRequestID()
+		ctx.Request.Header.Set(tusdReservationHeader, token)
+		var writer http.ResponseWriter = ctx.Writer
+		if policy.expiration > 0 {
+			writer = &tusdExpiresWriter{ResponseWriter: ctx.Writer, request: ctx.Request, composer: composer, ttl: policy.expiration}
+		}
+		stripHandle.ServeHTTP(writer, ctx.Request)
+		if ctx.Request.Method == http.MethodPost && writer.Header().Get("Location") == "" {
+			// 没有创建上传, 不会有 CreatedUploads 事件
+			policy.cancel(token)
+		}
+	}
+	group := s.App.Group(prefix, policy.middlewares...)
+	if prefix != "" {
+		group.Any("", serve)
+	}
+	group.Any("/", serve)
+	group.Any("/:id", serve)
+	s.tusdEndpoints = append(s.tusdEndpoints, endpoint)
+	return endpoint, nil
+}
+
+// close 停止事件分发和 janitor
+func (endpoint *TusdEndpoint) close() {
+	endpoint.once.Do(func() {
+		close(endpoint.stop)
+		if endpoint.janitor != nil {
+			endpoint.janitor.close()
+		}
+	})
+}
+
+// Path 上传入口路径, 以 / 结尾
+func (endpoint *TusdEndpoint) Path() string {
+	return endpoint.basePath
+}
+
+// uploadID 返回 URL 中属于该入口的上传 ID
+func (endpoint *TusdEndpoint) uploadID(u *url.URL) (string, bool) {
+	id, ok := strings.CutPrefix(u.Path, endpoint.basePath)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// 传递给 tusd 钩子的内部请求头, 客户端传入的值会被覆盖
+const (
+	// tusdPrincipalHeader 调用方
+	tusdPrincipalHeader = "X-Apigo-Principal"
+	// tusdClientIPHeader 未认证时的调用方, 即 ClientIP
+	tusdClientIPHeader = "X-Apigo-Client-IP"
+	// tusdReservationHeader 关联创建前占用的配额和创建的上传
+	tusdReservationHeader = "X-Apigo-Reservation"
+)
+
+// TusdPrincipal 返回触发钩子的调用方(SetPrincipal 设置), 未认证时为空
+func TusdPrincipal(event tusd.HookEvent) string {
+	return event.HTTPRequest.Header.Get(tusdPrincipalHeader)
+}
+
+// TusdHook 上传事件回调, 在单独的 goroutine 中按顺序调用, 应尽快返回
+type TusdHook func(event tusd.HookEvent)
+
+// TusdPreCreateHook 创建上传前调用, 返回错误时拒绝上传
+// 错误未实现 tusd.HTTPError 时以 403 返回
+type TusdPreCreateHook func(event tusd.HookEvent) error
+
+type tusdHooks struct {
+	mu         sync.RWMutex
+	preCreate  []TusdPreCreateHook
+	created    []TusdHook
+	progress   []TusdHook
+	finished   []TusdHook
+	terminated []TusdHook
+}
+
+func (hooks *tusdHooks) preCreateCallback(event tusd.HookEvent) error {
+	hooks.mu.RLock()
+	preCreate := hooks.preCreate
+	hooks.mu.RUnlock()
+	for _, hook := range preCreate {
+		if err := hook(event); err != nil {
+			if _, ok := err.(tusd.HTTPError); ok {
+				return err
+			}
+			return tusd.NewHTTPError(err, http.StatusForbidden)
+		}
+	}
+	return nil
+}
+
+// listen 将事件分发给注册的回调, stop 关闭后返回
+func (hooks *tusdHooks) listen(stop <-chan struct{}, events <-chan tusd.HookEvent, list *[]TusdHook) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-events:
+			hooks.dispatch(event, list)
+		}
+	}
+}
+
+// dispatch 依次调用内部回调 internal 及注册的回调
+func (hooks *tusdHooks) dispatch(event tusd.HookEvent, list *[]TusdHook, internal ...TusdHook) {
+	hooks.mu.RLock()
+	callbacks := append(internal[:len(internal):len(internal)], *list...)
+	hooks.mu.RUnlock()
+	for _, callback := range callbacks {
+		hooks.call(callback, event)
+	}
+}
+
+// listenUploads 在同一个 goroutine 中处理创建、完成和终止事件, 配额总是先关联后释放
+func (endpoint *TusdEndpoint) listenUploads(handler *tusd.Handler) {
+	hooks, policy := &endpoint.hooks, endpoint.policy
+	release := func(event tusd.HookEvent) {
+		policy.release(event.Upload.ID)
+	}
+	for {
+		select {
+		case <-endpoint.stop:
+			return
+		case event := <-handler.CreatedUploads:
+			hooks.dispatch(event, &hooks.created, policy.reserve)
+		case event := <-handler.CompleteUploads:
+			hooks.dispatch(event, &hooks.finished, release)
+		case event := <-handler.TerminatedUploads:
+			hooks.dispatch(event, &hooks.terminated, release)
+		}
+	}
+}
+
+func (hooks *tusdHooks) call(callback TusdHook, event tusd.HookEvent) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("apigo: tus hook panic", "upload", event.Upload.ID, "panic", recovered)
+		}
+	}()
+	callback(event)
+}
+
+func (hooks *tusdHooks) add(list *[]TusdHook, hook TusdHook) {
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	*list = append(*list, hook)
+}
+
+// OnUploadPreCreate 注册创建上传前的检查, 可根据 Upload-Metadata 或 TusdPrincipal 拒绝上传
+func (endpoint *TusdEndpoint) OnUploadPreCreate(hook TusdPreCreateHook) {
+	endpoint.hooks.mu.Lock()
+	defer endpoint.hooks.mu.Unlock()
+	endpoint.hooks.preCreate = append(endpoint.hooks.preCreate, hook)
+}
+
+// OnUploadCreated 注册上传创建回调
+func (endpoint *TusdEndpoint) OnUploadCreated(hook TusdHook) {
+	endpoint.hooks.add(&endpoint.hooks.created, hook)
+}
+
+// OnUploadProgress 注册上传进度回调, 每个 PATCH 请求约每秒触发一次
+func (endpoint *TusdEndpoint) OnUploadProgress(hook TusdHook) {
+	endpoint.hooks.add(&endpoint.hooks.progress, hook)
+}
+
+// OnUploadFinished 注册上传完成回调
+func (endpoint *TusdEndpoint) OnUploadFinished(hook TusdHook) {
+	endpoint.hooks.add(&endpoint.hooks.finished, hook)
+}
+
+// OnUploadTerminated 注册上传终止回调
+func (endpoint *TusdEndpoint) OnUploadTerminated(hook TusdHook) {
+	endpoint.hooks.add(&endpoint.hooks.terminated, hook)
+}
+
+type tusdRequest struct {
+	URLs  []string `json:"urls"`
+	Extra any      `json:"tag"`
+}
+
+type tusdResponse struct {
+	Success map[string]any    `json:"success"`
+	Failed  map[string]string `json:"failed"`
+}
+
+var errTusdIncomplete = errors.New("upload is not complete")
+
+// contextReader 在 context 结束后停止读取
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+var errTusdUnknownURL = errors.New("upload url does not belong to any endpoint")
+
+// resolve 返回 URL 对应的上传入口和上传 ID, endpoint 不为空时只接受该入口的 URL
+func (s *Server) tusdResolve(endpoint *TusdEndpoint, URL string) (*TusdEndpoint, string, error) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return nil, "", err
+	}
+	if endpoint != nil {
+		if id, ok := endpoint.uploadID(u); ok {
+			return endpoint, id, nil
+		}
+		return nil, "", errTusdUnknownURL
+	}
+	for _, endpoint := range s.tusdEndpoints {
+		if id, ok := endpoint.uploadID(u); ok {
+			return endpoint, id, nil
+		}
+	}
+	return nil, "", errTusdUnknownURL
+}
+
+func (endpoint *TusdEndpoint) process(ctx *gin.Context, id string, extra any, handle TusdHandle, options *tusdHandleOptions) (any, error) {
+	fctx := ctx.Copy()
+	rctx := ctx.Request.Context()
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(rctx, options.timeout)
+		defer cancel()
+	}
+	fctx.Request = ctx.Request.WithContext(rctx)
+	upload, err := endpoint.composer.Core.GetUpload(rctx, id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := upload.GetInfo(rctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		return nil, errTusdIncomplete
+	}
+	reader, err := upload.GetReader(rctx)
+	if err != nil {
+		return nil, err
+	}
+	// handle 返回(或 panic)后即关闭, 之后才能删除上传
+	result, err := func() (any, error) {
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		return handle(fctx, &contextReader{ctx: rctx, reader: reader}, &info, extra)
+	}()
+	if err == nil && rctx.Err() != nil {
+		err = rctx.Err()
+	}
+	if err == nil && options.deleteConsumed {
+		if err := endpoint.terminate(upload, info.ID); err != nil {
+			slog.Error("apigo: tus delete consumed", "upload", info.ID, "error", err)
+		} else {
+			endpoint.policy.release(info.ID)
+		}
+	}
+	return result, err
+}
+
+// terminate 持有上传锁时删除上传
+func (endpoint *TusdEndpoint) terminate(upload tusd.Upload, id string) error {
+	lock, err := tusdLock(endpoint.composer, id)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return tusdTerminate(context.Background(), endpoint.composer, upload)
+}
+
+func (s *Server) tusdUploaded(ctx *gin.Context, endpoint *TusdEndpoint, handle TusdHandle, options *tusdHandleOptions) {
+	var request tusdRequest
+	if err := ctx.BindJSON(&request); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	response := &tusdResponse{
+		Success: make(map[string]any),
+		Failed:  make(map[string]string),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, options.concurrency)
+	for _, URL := range request.URLs {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(URL string) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					mu.Lock()
+					response.Failed[URL] = fmt.Sprintf("panic: %v", recovered)
+					mu.Unlock()
+				}
+				<-limit
+				wg.Done()
+			}()
+			var result any
+			owner, id, err := s.tusdResolve(endpoint, URL)
+			if err == nil {
+				result, err = owner.process(ctx, id, request.Extra, handle, options)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				response.Failed[URL] = err.Error()
+			} else {
+				response.Success[URL] = result
+			}
+		}(URL)
+	}
+	wg.Wait()
+	ctx.JSON(http.StatusOK, response)
+}
+
+func newTusdHandleOptions(options []TusdHandleOption) *tusdHandleOptions {
+	opts := &tusdHandleOptions{concurrency: 4}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.concurrency <= 0 {
+		opts.concurrency = 1
+	}
+	return opts
+}
+
+// TusdHandle 处理上传完成的文件, 请求格式 {"urls": [...], "tag": any}, URL 可属于任一上传入口
+func (s *Server) TusdHandle(path string, handle TusdHandle, options ...TusdHandleOption) {
+	opts := newTusdHandleOptions(options)
+	s.App.POST(path, func(ctx *gin.Context) {
+		s.tusdUploaded(ctx, nil, handle, opts)
+	})
+}
+
+// Handle 处理该入口上传完成的文件, 其它入口的 URL 视为失败
+func (endpoint *TusdEndpoint) Handle(path string, handle TusdHandle, options ...TusdHandleOption) {
+	opts := newTusdHandleOptions(options)
+	endpoint.server.App.POST(path, func(ctx *gin.Context) {
+		endpoint.server.tusdUploaded(ctx, endpoint, handle, opts)
+	})
+}
@@ -0,0 +1,163 @@
+package apigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tus/tusd/pkg/filestore"
+	tusd "github.com/tus/tusd/pkg/handler"
+)
+
+// tusCreate 创建上传并返回上传 ID
+func tusCreate(t *testing.T, s *Server, headers map[string]string) (string, int) {
+	t.Helper()
+	created := tusRequest(t, s, http.MethodPost, "/files/", nil, headers)
+	return path.Base(created.Header().Get("Location")), created.Code
+}
+
+func tusPatch(t *testing.T, s *Server, id string, offset int, data []byte, headers map[string]string) {
+	t.Helper()
+	all := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": fmt.Sprint(offset)}
+	for key, value := range headers {
+		all[key] = value
+	}
+	if patched := tusRequest(t, s, http.MethodPatch, "/files/"+id, data, all); patched.Code != http.StatusNoContent {
+		t.Fatalf("patch %s: status %d: %s", id, patched.Code, patched.Body)
+	}
+}
+
+// waitUsage 等待事件处理后的配额占用
+func waitUsage(t *testing.T, policy *tusdPolicy, owner string, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		policy.mu.Lock()
+		usage := policy.usage[owner]
+		policy.mu.Unlock()
+		if usage == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("usage %d, want %d", usage, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTusdQuota(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	endpoint, err := s.TusdUploadStore(filestore.New(t.TempDir()), "/files/", WithTusdQuota(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// httptest 请求的 ClientIP
+	const owner = "192.0.2.1"
+	length := func(n int) map[string]string {
+		return map[string]string{"Upload-Length": fmt.Sprint(n)}
+	}
+	first, code := tusCreate(t, s, length(6))
+	if code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	waitUsage(t, endpoint.policy, owner, 6)
+	for _, test := range []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "over quota", headers: length(6), want: http.StatusRequestEntityTooLarge},
+		{name: "deferred length", headers: map[string]string{"Upload-Defer-Length": "1"}, want: http.StatusBadRequest},
+	} {
+		if _, code := tusCreate(t, s, test.headers); code != test.want {
+			t.Fatalf("%s: status %d, want %d", test.name, code, test.want)
+		}
+	}
+	// 被拒绝的请求不占用配额
+	waitUsage(t, endpoint.policy, owner, 6)
+	second, code := tusCreate(t, s, length(4))
+	if code != http.StatusCreated {
+		t.Fatalf("create within quota: status %d", code)
+	}
+	waitUsage(t, endpoint.policy, owner, 10)
+
+	// 完成后释放
+	tusPatch(t, s, first, 0, []byte("hello!"), nil)
+	waitUsage(t, endpoint.policy, owner, 4)
+	// 终止后释放
+	if deleted := tusRequest(t, s, http.MethodDelete, "/files/"+second, nil, nil); deleted.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", deleted.Code)
+	}
+	waitUsage(t, endpoint.policy, owner, 0)
+	if _, code := tusCreate(t, s, length(10)); code != http.StatusCreated {
+		t.Fatalf("create after release: status %d", code)
+	}
+}
+
+func TestTusdHandleIncomplete(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	if _, err := s.TusdUploadStore(filestore.New(t.TempDir()), "/files/"); err != nil {
+		t.Fatal(err)
+	}
+	var handled []string
+	s.TusdHandle("/done", func(ctx *gin.Context, reader io.Reader, info *tusd.FileInfo, extra any) (any, error) {
+		data, err := io.ReadAll(reader)
+		handled = append(handled, string(data))
+		return len(data), err
+	}, WithTusdConcurrency(1))
+	for _, test := range []struct {
+		name   string
+		create map[string]string
+		data   string
+		// length 不为空时在最后一次写入中声明长度
+		length  string
+		success bool
+	}{
+		{name: "complete", create: map[string]string{"Upload-Length": "5"}, data: "hello", success: true},
+		{name: "partial", create: map[string]string{"Upload-Length": "10"}, data: "hello"},
+		{name: "deferred", create: map[string]string{"Upload-Defer-Length": "1"}, data: "hello"},
+		{name: "deferred declared", create: map[string]string{"Upload-Defer-Length": "1"}, data: "hello", length: "5", success: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			handled = nil
+			id, code := tusCreate(t, s, test.create)
+			if code != http.StatusCreated {
+				t.Fatalf("create: status %d", code)
+			}
+			var headers map[string]string
+			if test.length != "" {
+				headers = map[string]string{"Upload-Length": test.length}
+			}
+			tusPatch(t, s, id, 0, []byte(test.data), headers)
+			url := "http://example.com/files/" + id
+			body, _ := json.Marshal(&tusdRequest{URLs: []string{url}})
+			request := httptest.NewRequest(http.MethodPost, "/done", bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			s.App.ServeHTTP(recorder, request)
+			var response tusdResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response %s: %v", recorder.Body, err)
+			}
+			if test.success {
+				if _, ok := response.Success[url]; !ok || len(handled) != 1 || handled[0] != test.data {
+					t.Fatalf("response %+v, handled %q", response, handled)
+				}
+				return
+			}
+			if !strings.Contains(response.Failed[url], errTusdIncomplete.Error()) || len(handled) != 0 {
+				t.Fatalf("response %+v, handled %q, want %v", response, handled, errTusdIncomplete)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package apigo
+
+import "reflect"
+
+// TypeKind 解析后类型的种类
+type TypeKind int
+
+const (
+	KindBasic TypeKind = iota
+	KindStruct
+	KindPointer
+	KindSlice
+	KindArray
+	KindMap
+	KindInterface
+	KindChan
+	KindFunc
+)
+
+// TypeInfo gen.Resolve 解析出的类型结构, 包括其他模块中的类型
+// 命名类型的 Name/PkgPath 不为空, Kind 等为其底层类型; 递归类型共用同一个 *TypeInfo
+type TypeInfo struct {
+	Kind    TypeKind
+	Name    string
+	PkgPath string
+	// Basic 基础类型名, 如 int64, Kind 为 KindBasic 时有效
+	Basic string
+	// Elem 指针/切片/数组/map/channel 的元素类型
+	Elem *TypeInfo
+	// Key map 的键类型
+	Key *TypeInfo
+	// Len 数组长度
+	Len int64
+	// Fields 结构体按 json 编码的字段, 嵌入结构体的字段已展开
+	Fields []*FieldInfo
+}
+
+// FullName 命名类型的完整名称, 如 time.Time 为 "time.Time"
+func (info *TypeInfo) FullName() string {
+	if info.PkgPath == "" {
+		return info.Name
+	}
+	return info.PkgPath + "." + info.Name
+}
+
+// FieldInfo 结构体字段
+type FieldInfo struct {
+	Name string
+	// JSONName json 编码时的名称
+	JSONName  string
+	OmitEmpty bool
+	Tag       reflect.StructTag
+	Type      *TypeInfo
+}
+
+// JSDocTypes WriteJS 使用的 JSDoc 类型, gen.Resolve 后设置 Parser.JSDoc
+type JSDocTypes interface {
+	// Type 类型对应的 JSDoc 类型, 引用的命名结构体记录为 typedef
+	Type(info *TypeInfo) string
+	// Typedefs 所有记录的 typedef
+	Typedefs() string
+}
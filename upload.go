@@ -0,0 +1,394 @@
+package apigo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zdypro888/net"
+)
+
+const tusVersion = "1.0.0"
+
+// UploadStore 保存上传 URL, 用于断点续传
+type UploadStore interface {
+	Get(fingerprint string) (string, bool)
+	Set(fingerprint, uploadURL string) error
+	Delete(fingerprint string) error
+}
+
+// MemoryUploadStore 进程内的 UploadStore
+type MemoryUploadStore struct {
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+func (store *MemoryUploadStore) Get(fingerprint string) (string, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	uploadURL, ok := store.urls[fingerprint]
+	return uploadURL, ok
+}
+
+func (store *MemoryUploadStore) Set(fingerprint, uploadURL string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.urls == nil {
+		store.urls = make(map[string]string)
+	}
+	store.urls[fingerprint] = uploadURL
+	return nil
+}
+
+func (store *MemoryUploadStore) Delete(fingerprint string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.urls, fingerprint)
+	return nil
+}
+
+// FileUploadStore 保存在 JSON 文件中的 UploadStore, 进程重启后可继续上传
+type FileUploadStore struct {
+	mu   sync.Mutex
+	Path string
+}
+
+func (store *FileUploadStore) load() map[string]string {
+	urls := make(map[string]string)
+	if data, err := os.ReadFile(store.Path); err == nil {
+		json.Unmarshal(data, &urls)
+	}
+	return urls
+}
+
+func (store *FileUploadStore) save(urls map[string]string) error {
+	data, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(store.Path, data, 0644)
+}
+
+func (store *FileUploadStore) Get(fingerprint string) (string, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	uploadURL, ok := store.load()[fingerprint]
+	return uploadURL, ok
+}
+
+func (store *FileUploadStore) Set(fingerprint, uploadURL string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	urls := store.load()
+	urls[fingerprint] = uploadURL
+	return store.save(urls)
+}
+
+func (store *FileUploadStore) Delete(fingerprint string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	urls := store.load()
+	delete(urls, fingerprint)
+	return store.save(urls)
+}
+
+// UploadOption Client.Upload 选项
+type UploadOption func(options *uploadOptions)
+
+type uploadOptions struct {
+	chunkSize   int64
+	size        int64
+	retries     int
+	store       UploadStore
+	fingerprint string
+	progress    func(uploaded, total int64)
+}
+
+// WithUploadChunkSize 每个 PATCH 请求的大小, 默认 4MB, 必须大于 0
+func WithUploadChunkSize(size int64) UploadOption {
+	return func(options *uploadOptions) {
+		options.chunkSize = size
+	}
+}
+
+// WithUploadSize 文件大小, reader 不支持 io.Seeker 时必须设置
+func WithUploadSize(size int64) UploadOption {
+	return func(options *uploadOptions) {
+		options.size = size
+	}
+}
+
+// WithUploadRetries PATCH 失败后重新查询偏移并重试的次数, 默认 3, 需要 reader 支持 io.Seeker
+func WithUploadRetries(retries int) UploadOption {
+	return func(options *uploadOptions) {
+		options.retries = retries
+	}
+}
+
+// WithUploadResume 使用 store 按 fingerprint 保存上传 URL, 相同 fingerprint 的上传从服务端偏移继续
+func WithUploadResume(store UploadStore, fingerprint string) UploadOption {
+	return func(options *uploadOptions) {
+		options.store = store
+		options.fingerprint = fingerprint
+	}
+}
+
+// WithUploadProgress 每个分块完成后回调
+func WithUploadProgress(progress func(uploaded, total int64)) UploadOption {
+	return func(options *uploadOptions) {
+		options.progress = progress
+	}
+}
+
+var (
+	errUploadSize    = errors.New("upload size is unknown, use WithUploadSize")
+	errUploadSeek    = errors.New("reader does not support seeking")
+	errUploadOffset  = errors.New("invalid Upload-Offset in response")
+	errUploadCreated = errors.New("missing Location in response")
+	// errUploadChunkSize 为 0 时会不断发送空 PATCH
+	errUploadChunkSize = errors.New("upload chunk size must be positive")
+)
+
+// UploadError tus 请求返回了非预期的状态码
+type UploadError struct {
+	Method     string
+	StatusCode int
+	Body       string
+}
+
+func (err *UploadError) Error() string {
+	return fmt.Sprintf("tus %s: status %d: %s", err.Method, err.StatusCode, strings.TrimSpace(err.Body))
+}
+
+func encodeUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (c *Client) tusRequest(ctx context.Context, method, uploadURL string, headers http.Header, body []byte, expect int) (*net.Response, error) {
+	headers.Set("Tus-Resumable", tusVersion)
+	headers.Set(RequestIDHeader, outgoingRequestID(ctx))
+	res, err := c.client.RequestMethod(ctx, uploadURL, method, headers, net.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != expect {
+		data, _ := res.Data()
+		return nil, &UploadError{Method: method, StatusCode: res.StatusCode, Body: string(data)}
+	}
+	return res, nil
+}
+
+func (c *Client) tusCreate(ctx context.Context, endpoint string, size int64, metadata map[string]string) (string, error) {
+	headers := http.Header{}
+	headers.Set("Upload-Length", strconv.FormatInt(size, 10))
+	if len(metadata) > 0 {
+		headers.Set("Upload-Metadata", encodeUploadMetadata(metadata))
+	}
+	res, err := c.tusRequest(ctx, http.MethodPost, endpoint, headers, nil, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	location := res.Header.Get("Location")
+	if location == "" {
+		return "", errUploadCreated
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (c *Client) tusOffset(ctx context.Context, uploadURL string) (int64, error) {
+	res, err := c.tusRequest(ctx, http.MethodHead, uploadURL, http.Header{}, nil, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(res.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, errUploadOffset
+	}
+	return offset, nil
+}
+
+func (c *Client) tusPatch(ctx context.Context, uploadURL string, offset int64, chunk []byte) (int64, error) {
+	headers := http.Header{}
+	headers.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	headers.Set("Content-Type", "application/offset+octet-stream")
+	res, err := c.tusRequest(ctx, http.MethodPatch, uploadURL, headers, chunk, http.StatusNoContent)
+	if err != nil {
+		return 0, err
+	}
+	next, err := strconv.ParseInt(res.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, errUploadOffset
+	}
+	return next, nil
+}
+
+// seekUpload 将 reader 定位到 offset, 不支持 io.Seeker 时只能向前跳过
+func seekUpload(reader io.Reader, current, offset int64) error {
+	if current == offset {
+		return nil
+	}
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+	if offset < current {
+		return errUploadSeek
+	}
+	_, err := io.CopyN(io.Discard, reader, offset-current)
+	return err
+}
+
+// Upload 使用 tus 协议上传 reader, 返回上传 URL, 可传给 ProcessUploads
+// path: 服务端 TusdUpload 的路径, 如 /upload/
+func (c *Client) Upload(ctx context.Context, path string, reader io.Reader, metadata map[string]string, options ...UploadOption) (string, error) {
+	opts := &uploadOptions{chunkSize: 4 << 20, size: -1, retries: 3}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.chunkSize <= 0 {
+		return "", errUploadChunkSize
+	}
+	size := opts.size
+	if size < 0 {
+		seeker, ok := reader.(io.Seeker)
+		if !ok {
+			return "", errUploadSize
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return "", err
+		}
+		if _, err = seeker.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		size = end
+	}
+	var uploadURL string
+	var offset int64
+	if opts.store != nil && opts.fingerprint != "" {
+		if stored, ok := opts.store.Get(opts.fingerprint); ok {
+			if serverOffset, err := c.tusOffset(ctx, stored); err == nil && serverOffset <= size {
+				uploadURL, offset = stored, serverOffset
+			} else {
+				opts.store.Delete(opts.fingerprint)
+			}
+		}
+	}
+	if uploadURL == "" {
+		var err error
+		if uploadURL, err = c.tusCreate(ctx, c.BuildURL(path), size, metadata); err != nil {
+			return "", err
+		}
+		if opts.store != nil && opts.fingerprint != "" {
+			if err = opts.store.Set(opts.fingerprint, uploadURL); err != nil {
+				return "", err
+			}
+		}
+	}
+	var position int64
+	if err := seekUpload(reader, position, offset); err != nil {
+		return "", err
+	}
+	position = offset
+	if opts.progress != nil {
+		opts.progress(offset, size)
+	}
+	chunk := make([]byte, opts.chunkSize)
+	retries := opts.retries
+	for offset < size {
+		n, err := io.ReadFull(reader, chunk[:min(opts.chunkSize, size-offset)])
+		if err != nil {
+			return "", err
+		}
+		position += int64(n)
+		next, err := c.tusPatch(ctx, uploadURL, offset, chunk[:n])
+		if err != nil {
+			if retries <= 0 || ctx.Err() != nil {
+				return "", err
+			}
+			retries--
+			// 重新查询服务端偏移后从该位置继续
+			if next, err = c.tusOffset(ctx, uploadURL); err != nil {
+				return "", err
+			}
+		}
+		if err = seekUpload(reader, position, next); err != nil {
+			return "", err
+		}
+		position, offset = next, next
+		if opts.progress != nil {
+			opts.progress(offset, size)
+		}
+	}
+	if opts.store != nil && opts.fingerprint != "" {
+		opts.store.Delete(opts.fingerprint)
+	}
+	return uploadURL, nil
+}
+
+// UploadResult TusdHandle 的处理结果
+type UploadResult[T any] struct {
+	Success map[string]T      `json:"success" bson:"success"`
+	Failed  map[string]string `json:"failed" bson:"failed"`
+}
+
+// ProcessUploads 调用服务端 TusdHandle 处理上传完成的文件
+// path: TusdHandle 的路径, tag: 传给 TusdHandle 的 extra
+func ProcessUploads[T any](ctx context.Context, c *Client, path string, urls []string, tag any) (*UploadResult[T], error) {
+	data, err := json.Marshal(&tusdRequest{URLs: urls, Extra: tag})
+	if err != nil {
+		return nil, err
+	}
+	var result UploadResult[T]
+	if err = doRequest(ctx, c, path, http.MethodPost, data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UploadAndProcess 上传后立即调用 TusdHandle, 返回该文件的处理结果
+func UploadAndProcess[T any](ctx context.Context, c *Client, uploadPath, handlePath string, reader io.Reader, metadata map[string]string, tag any, options ...UploadOption) (*T, error) {
+	uploadURL, err := c.Upload(ctx, uploadPath, reader, metadata, options...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ProcessUploads[T](ctx, c, handlePath, []string{uploadURL}, tag)
+	if err != nil {
+		return nil, err
+	}
+	if reason, ok := result.Failed[uploadURL]; ok {
+		return nil, errors.New(reason)
+	}
+	value, ok := result.Success[uploadURL]
+	if !ok {
+		return nil, fmt.Errorf("no result for %s", uploadURL)
+	}
+	return &value, nil
+}